@@ -23,9 +23,18 @@ const (
 )
 
 func inputMissingParams(config *commons.Config, stdinClosed bool) error {
+	err := inputMissingAMQPParams(config, stdinClosed)
+	if err != nil {
+		return err
+	}
+
+	return inputMissingIRODSParams(config, stdinClosed)
+}
+
+func inputMissingAMQPParams(config *commons.Config, stdinClosed bool) error {
 	logger := log.WithFields(log.Fields{
 		"package":  "main",
-		"function": "inputMissingParams",
+		"function": "inputMissingAMQPParams",
 	})
 
 	if len(config.AMQPUsername) == 0 {
@@ -57,6 +66,15 @@ func inputMissingParams(config *commons.Config, stdinClosed bool) error {
 		config.AMQPPassword = string(bytePassword)
 	}
 
+	return nil
+}
+
+func inputMissingIRODSParams(config *commons.Config, stdinClosed bool) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "main",
+		"function": "inputMissingIRODSParams",
+	})
+
 	if len(config.IRODSUsername) == 0 {
 		if stdinClosed {
 			err := fmt.Errorf("IRODS user is not set")
@@ -65,7 +83,7 @@ func inputMissingParams(config *commons.Config, stdinClosed bool) error {
 		}
 
 		fmt.Print("IRODS Username: ")
-		fmt.Scanln(&config.AMQPUsername)
+		fmt.Scanln(&config.IRODSUsername)
 	}
 
 	if len(config.IRODSPassword) == 0 {
@@ -98,6 +116,11 @@ func processArguments() (*commons.Config, io.WriteCloser, error, bool) {
 	var version bool
 	var help bool
 	var configFilePath string
+	var dryRun bool
+	var capturePath string
+	var replayCapturePath string
+	var replaySpeed float64
+	var replaySequential bool
 
 	config := commons.NewDefaultConfig()
 
@@ -109,6 +132,11 @@ func processArguments() (*commons.Config, io.WriteCloser, error, bool) {
 	flag.BoolVar(&config.Foreground, "f", false, "Run in foreground")
 	flag.BoolVar(&config.ChildProcess, ChildProcessArgument, false, "")
 	flag.StringVar(&config.LogPath, "log", commons.LogFilePathDefault, "Set log file path")
+	flag.BoolVar(&dryRun, "dry-run", false, "Record planned purge requests without sending them")
+	flag.StringVar(&capturePath, "capture", "", "Record raw AMQP deliveries to the file")
+	flag.StringVar(&replayCapturePath, "replay-capture", "", "Read deliveries from the capture file instead of AMQP")
+	flag.Float64Var(&replaySpeed, "replay-speed", commons.ReplaySpeedDefault, "Set replay speed, 0 replays without delays")
+	flag.BoolVar(&replaySequential, "replay-sequential", false, "Handle replayed events one by one")
 
 	flag.Parse()
 
@@ -141,13 +169,58 @@ func processArguments() (*commons.Config, io.WriteCloser, error, bool) {
 
 	logger.Infof("Logging to %s", config.LogPath)
 
+	config, stdinClosed, err := loadConfig(config, configFilePath)
+	if err != nil {
+		return nil, logWriter, err, true
+	}
+
+	if dryRun {
+		config.DryRun = true
+	}
+
+	// flags given override configuration
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "capture":
+			config.CapturePath = capturePath
+		case "replay-capture":
+			config.ReplayCapturePath = replayCapturePath
+		case "replay-speed":
+			config.ReplaySpeed = replaySpeed
+		case "replay-sequential":
+			config.ReplaySequential = replaySequential
+		}
+	})
+
+	if len(config.ReplayCapturePath) > 0 {
+		// AMQP is not used
+		err = inputMissingIRODSParams(config, stdinClosed)
+	} else {
+		err = inputMissingParams(config, stdinClosed)
+	}
+	if err != nil {
+		logger.WithError(err).Error("Could not input missing parameters")
+		return nil, logWriter, err, true
+	}
+
+	return config, logWriter, nil, false
+}
+
+// loadConfig reads configuration from ENV, STDIN ("-") or a YAML file over the given config
+// returns true if STDIN is consumed
+func loadConfig(config *commons.Config, configFilePath string) (*commons.Config, bool, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "main",
+		"function": "loadConfig",
+	})
+
 	stdinClosed := false
 	if len(configFilePath) == 0 {
 		// read from Environmental variables
 		envConfig, err := commons.NewConfigFromENV()
 		if err != nil {
 			logger.WithError(err).Error("failed to read Environmental Variables")
-			return nil, logWriter, err, true
+			return nil, false, err
 		}
 
 		envConfig.Foreground = config.Foreground
@@ -159,12 +232,12 @@ func processArguments() (*commons.Config, io.WriteCloser, error, bool) {
 		yamlBytes, err := ioutil.ReadAll(stdinReader)
 		if err != nil {
 			logger.WithError(err).Error("failed to read STDIN")
-			return nil, logWriter, err, true
+			return nil, false, err
 		}
 
 		err = yaml.Unmarshal(yamlBytes, &config)
 		if err != nil {
-			return nil, logWriter, fmt.Errorf("failed to unmarshal YAML - %v", err), true
+			return nil, false, fmt.Errorf("failed to unmarshal YAML - %v", err)
 		}
 
 		stdinClosed = true
@@ -173,39 +246,60 @@ func processArguments() (*commons.Config, io.WriteCloser, error, bool) {
 		configFileAbsPath, err := filepath.Abs(configFilePath)
 		if err != nil {
 			logger.WithError(err).Errorf("failed to access the local yaml file %s", configFilePath)
-			return nil, logWriter, err, true
+			return nil, false, err
 		}
 
 		fileinfo, err := os.Stat(configFileAbsPath)
 		if err != nil {
 			logger.WithError(err).Errorf("failed to access the local yaml file %s", configFileAbsPath)
-			return nil, logWriter, err, true
+			return nil, false, err
 		}
 
 		if fileinfo.IsDir() {
 			logger.WithError(err).Errorf("local yaml file %s is not a file", configFileAbsPath)
-			return nil, logWriter, fmt.Errorf("local yaml file %s is not a file", configFileAbsPath), true
+			return nil, false, fmt.Errorf("local yaml file %s is not a file", configFileAbsPath)
 		}
 
 		yamlBytes, err := ioutil.ReadFile(configFileAbsPath)
 		if err != nil {
 			logger.WithError(err).Errorf("failed to read the local yaml file %s", configFileAbsPath)
-			return nil, logWriter, err, true
+			return nil, false, err
 		}
 
 		err = yaml.Unmarshal(yamlBytes, &config)
 		if err != nil {
-			return nil, logWriter, fmt.Errorf("failed to unmarshal YAML - %v", err), true
+			return nil, false, fmt.Errorf("failed to unmarshal YAML - %v", err)
 		}
 	}
 
-	err := inputMissingParams(config, stdinClosed)
+	warnings, err := config.MigrateLegacyTargets()
 	if err != nil {
-		logger.WithError(err).Error("Could not input missing parameters")
-		return nil, logWriter, err, true
+		logger.WithError(err).Error("Could not migrate deprecated settings")
+		return nil, false, err
 	}
 
-	return config, logWriter, nil, false
+	for _, warning := range warnings {
+		logger.Warn(warning)
+	}
+
+	return config, stdinClosed, nil
+}
+
+// ignoreDaemonFiles clears paths of files owned by the daemon, so one-shot commands do not touch them
+// while the daemon is running with the same config
+func ignoreDaemonFiles(config *commons.Config) {
+	logger := log.WithFields(log.Fields{
+		"package":  "main",
+		"function": "ignoreDaemonFiles",
+	})
+
+	config.PendingSpillPath = ""
+
+	// the journal is rotated by the daemon, purges sent are logged and printed instead
+	if len(config.AuditJournalPath) > 0 {
+		logger.Infof("Purges are not recorded in the audit journal %s", config.AuditJournalPath)
+		config.AuditJournalPath = ""
+	}
 }
 
 func getLogWriter(logPath string) io.WriteCloser {
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+	"github.com/cyverse/purgeman/pkg/purgeman"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// CheckCommand is a subcommand that validates configuration and checks connectivity, and exits
+	CheckCommand = "check"
+)
+
+// checkMain validates configuration, checks connections to AMQP, iRODS and targets, and prints results
+func checkMain(args []string) {
+	logger := log.WithFields(log.Fields{
+		"package":  "main",
+		"function": "checkMain",
+	})
+
+	var help bool
+	var verbose bool
+	var configFilePath string
+
+	flags := flag.NewFlagSet(CheckCommand, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [options]\n", os.Args[0], CheckCommand)
+		flags.PrintDefaults()
+	}
+
+	flags.BoolVar(&help, "h", false, "Print help")
+	flags.BoolVar(&verbose, "verbose", false, "Print informational logs")
+	flags.StringVar(&configFilePath, "config", "", "Set Config YAML File")
+
+	flags.Parse(args)
+
+	if help {
+		flags.Usage()
+		os.Exit(0)
+	}
+
+	log.SetOutput(os.Stderr)
+	if !verbose {
+		log.SetLevel(log.WarnLevel)
+	}
+
+	results := []*purgeman.CheckResult{}
+
+	config, stdinClosed, err := loadConfig(commons.NewDefaultConfig(), configFilePath)
+	if err == nil {
+		if len(config.ReplayCapturePath) > 0 {
+			// AMQP is not used
+			err = inputMissingIRODSParams(config, stdinClosed)
+		} else {
+			err = inputMissingParams(config, stdinClosed)
+		}
+	}
+
+	if err == nil {
+		err = config.Validate()
+	}
+
+	if err != nil {
+		results = append(results, &purgeman.CheckResult{
+			Name:   "config",
+			Status: purgeman.CheckStatusFail,
+			Detail: err.Error(),
+		})
+
+		// connections cannot be checked without valid configuration
+		printCheckResults(os.Stdout, results)
+		os.Exit(1)
+	}
+
+	results = append(results, &purgeman.CheckResult{
+		Name:   "config",
+		Status: purgeman.CheckStatusPass,
+		Detail: fmt.Sprintf("%d targets", len(config.Targets)),
+	})
+
+	for _, warning := range config.Warnings() {
+		results = append(results, &purgeman.CheckResult{
+			Name:   "config",
+			Status: purgeman.CheckStatusWarn,
+			Detail: warning,
+		})
+	}
+
+	results = append(results, purgeman.CheckAMQP(config)...)
+
+	// targets must receive requests even in dry-run mode
+	svcConfig := *config
+	svcConfig.DryRun = false
+	ignoreDaemonFiles(&svcConfig)
+
+	svc, err := purgeman.NewPurgeman(&svcConfig)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to create the service")
+	}
+
+	results = append(results, svc.CheckIRODS())
+	results = append(results, svc.CheckTargets()...)
+	svc.Destroy()
+
+	if printCheckResults(os.Stdout, results) > 0 {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+// printCheckResults prints a table of check results, returns the number of failures
+func printCheckResults(output io.Writer, results []*purgeman.CheckResult) int {
+	writer := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "CHECK\tRESULT\tDETAIL")
+
+	failed := 0
+	for _, result := range results {
+		if result.Status == purgeman.CheckStatusFail {
+			failed++
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", result.Name, result.Status, result.Detail)
+	}
+
+	writer.Flush()
+	return failed
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+	"github.com/cyverse/purgeman/pkg/purgeman"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// StatusCommand is a subcommand that shows the status of the running daemon
+	StatusCommand = "status"
+	// StopCommand is a subcommand that stops the running daemon
+	StopCommand = "stop"
+	// ReloadCommand is a subcommand that makes the running daemon restart its service with the config given
+	ReloadCommand = "reload"
+	// statusErrorsDefault is the number of recent errors shown by default
+	statusErrorsDefault = 10
+)
+
+// daemonController handles control requests for the service running in the daemon, and replaces the service on reloads
+type daemonController struct {
+	startTime    time.Time
+	reloadTime   *time.Time
+	recentErrors *purgeman.RecentErrors
+	svc          *purgeman.PurgemanService
+	next         *purgeman.PurgemanService // replaces svc when it stops, nil if not reloading
+	stopping     bool
+	mutex        sync.Mutex
+}
+
+func newDaemonController(svc *purgeman.PurgemanService, recentErrors *purgeman.RecentErrors) *daemonController {
+	return &daemonController{
+		startTime:    time.Now(),
+		recentErrors: recentErrors,
+		svc:          svc,
+	}
+}
+
+// takeNext returns the service replacing the one stopped, returns nil if the daemon must stop
+func (controller *daemonController) takeNext() *purgeman.PurgemanService {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+
+	next := controller.next
+	if next == nil {
+		return nil
+	}
+
+	now := time.Now()
+	controller.svc = next
+	controller.next = nil
+	controller.reloadTime = &now
+	return next
+}
+
+// handle handles a control request
+func (controller *daemonController) handle(request *purgeman.ControlRequest) *purgeman.ControlResponse {
+	logger := log.WithFields(log.Fields{
+		"package":  "main",
+		"struct":   "daemonController",
+		"function": "handle",
+	})
+
+	switch request.Command {
+	case purgeman.ControlCommandStatus:
+		return &purgeman.ControlResponse{
+			Status: controller.status(),
+		}
+	case purgeman.ControlCommandStop:
+		logger.Info("Stopping Purgeman on a control request")
+		controller.stop()
+		return &purgeman.ControlResponse{}
+	case purgeman.ControlCommandReload:
+		warnings, err := controller.reload(request.Config)
+		if err != nil {
+			return &purgeman.ControlResponse{
+				Error: err.Error(),
+			}
+		}
+
+		return &purgeman.ControlResponse{
+			Warnings: warnings,
+		}
+	default:
+		return &purgeman.ControlResponse{
+			Error: fmt.Sprintf("unknown control command %s", request.Command),
+		}
+	}
+}
+
+func (controller *daemonController) status() *purgeman.DaemonStatus {
+	controller.mutex.Lock()
+	svc := controller.svc
+	reloadTime := controller.reloadTime
+	controller.mutex.Unlock()
+
+	return &purgeman.DaemonStatus{
+		PID:           os.Getpid(),
+		Version:       commons.GetVersion(),
+		StartTime:     controller.startTime,
+		ReloadTime:    reloadTime,
+		Uptime:        time.Since(controller.startTime).Round(time.Second).String(),
+		ServiceStatus: svc.Status(),
+		Errors:        controller.recentErrors.Get(),
+	}
+}
+
+// stop stops the service and the one reloaded if any, the daemon terminates when it returns
+func (controller *daemonController) stop() {
+	controller.mutex.Lock()
+	controller.stopping = true
+	svc := controller.svc
+	next := controller.next
+	controller.next = nil
+	controller.mutex.Unlock()
+
+	if next != nil {
+		next.Destroy()
+	}
+	svc.Destroy()
+}
+
+// reload creates a service with the config given, and stops the service running to be replaced
+// the service running is kept if the config is invalid
+func (controller *daemonController) reload(configYAML string) ([]string, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "main",
+		"struct":   "daemonController",
+		"function": "reload",
+	})
+
+	config, err := commons.NewConfigFromYAML([]byte(configYAML))
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration - %v", err)
+	}
+
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+
+	if controller.stopping {
+		return nil, fmt.Errorf("purgeman is stopping")
+	}
+
+	if controller.next != nil {
+		return nil, fmt.Errorf("another reload is in progress")
+	}
+
+	// settings of the daemon process are kept
+	warnings := []string{}
+	oldConfig := controller.svc.Config
+	if config.LogPath != oldConfig.LogPath {
+		warnings = append(warnings, fmt.Sprintf("log path is not changed from %s, restart purgeman to change it", oldConfig.LogPath))
+		config.LogPath = oldConfig.LogPath
+	}
+
+	if config.ControlSocketPath != oldConfig.ControlSocketPath {
+		warnings = append(warnings, fmt.Sprintf("control socket path is not changed from %s, restart purgeman to change it", oldConfig.ControlSocketPath))
+		config.ControlSocketPath = oldConfig.ControlSocketPath
+	}
+
+	config.Foreground = oldConfig.Foreground
+	config.ChildProcess = oldConfig.ChildProcess
+	warnings = append(warnings, config.Warnings()...)
+
+	next, err := purgeman.NewPurgeman(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the service - %v", err)
+	}
+
+	old := controller.svc
+	logger.Infof("Reloading Purgeman, dropping %d events waiting for retry and %d pending events", old.RetryQueue.Len(), old.PendingEvents.Len())
+	controller.next = next
+
+	// the service running returns from Start, then the next one starts
+	go old.Destroy()
+	return warnings, nil
+}
+
+// resolveControlSocketPath returns the socket given, or the one in the config
+func resolveControlSocketPath(configFilePath string, socketPath string) (string, error) {
+	if len(socketPath) > 0 {
+		return socketPath, nil
+	}
+
+	config, _, err := loadConfig(commons.NewDefaultConfig(), configFilePath)
+	if err != nil {
+		return "", err
+	}
+
+	if len(config.ControlSocketPath) == 0 {
+		return "", fmt.Errorf("control socket is disabled, set control_socket_path or give -socket")
+	}
+	return config.ControlSocketPath, nil
+}
+
+// newControlFlagSet creates a flag set having options common to control commands
+func newControlFlagSet(command string, description string, help *bool, verbose *bool, configFilePath *string, socketPath *string) *flag.FlagSet {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [options]\n", os.Args[0], command)
+		fmt.Fprintln(flags.Output(), description)
+		flags.PrintDefaults()
+	}
+
+	flags.BoolVar(help, "h", false, "Print help")
+	flags.BoolVar(verbose, "verbose", false, "Print informational logs")
+	flags.StringVar(configFilePath, "config", "", "Set Config YAML File")
+	flags.StringVar(socketPath, "socket", "", "Set control socket path (default: control socket path in config)")
+	return flags
+}
+
+// statusMain shows the status of the running daemon
+func statusMain(args []string) {
+	logger := log.WithFields(log.Fields{
+		"package":  "main",
+		"function": "statusMain",
+	})
+
+	var help bool
+	var verbose bool
+	var configFilePath string
+	var socketPath string
+	var errors int
+
+	flags := newControlFlagSet(StatusCommand, "Shows the status of the running daemon.", &help, &verbose, &configFilePath, &socketPath)
+	flags.IntVar(&errors, "errors", statusErrorsDefault, fmt.Sprintf("Set the number of recent errors to show, up to %d", purgeman.RecentErrorsSize))
+	flags.Parse(args)
+
+	if help {
+		flags.Usage()
+		os.Exit(0)
+	}
+
+	log.SetOutput(os.Stderr)
+	if !verbose {
+		log.SetLevel(log.WarnLevel)
+	}
+
+	socketPath, err := resolveControlSocketPath(configFilePath, socketPath)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to find the control socket")
+	}
+
+	response, err := purgeman.SendControlRequest(socketPath, &purgeman.ControlRequest{
+		Command: purgeman.ControlCommandStatus,
+	})
+	if err != nil {
+		logger.WithError(err).Fatal("failed to get the status")
+	}
+
+	if response.Status == nil || response.Status.ServiceStatus == nil {
+		logger.Fatal("no status is returned")
+	}
+
+	printDaemonStatus(os.Stdout, response.Status, errors)
+	os.Exit(0)
+}
+
+// printDaemonStatus prints the status of the daemon with up to maxErrors recent errors
+func printDaemonStatus(output io.Writer, status *purgeman.DaemonStatus, maxErrors int) {
+	writer := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+
+	state := "running"
+	if status.Terminating {
+		state = "terminating"
+	} else if status.DryRun {
+		state = "running in dry-run mode"
+	}
+
+	version := status.Version.ServiceVersion
+	if len(version) == 0 {
+		version = "unknown"
+	}
+
+	fmt.Fprintf(writer, "State:\t%s\n", state)
+	fmt.Fprintf(writer, "PID:\t%d\n", status.PID)
+	fmt.Fprintf(writer, "Version:\t%s (commit %s, built %s)\n", version, status.Version.GitCommit, status.Version.BuildDate)
+	fmt.Fprintf(writer, "Uptime:\t%s (started %s)\n", status.Uptime, status.StartTime.Format(time.RFC3339))
+	if status.ReloadTime != nil {
+		fmt.Fprintf(writer, "Reloaded:\t%s\n", status.ReloadTime.Format(time.RFC3339))
+	}
+
+	consuming := "consuming"
+	if status.AMQPPaused {
+		consuming = "paused"
+	}
+	queue := status.Queue
+	if len(queue) == 0 {
+		queue = "not declared yet"
+	}
+	fmt.Fprintf(writer, "Queue:\t%s (%s)\n", queue, consuming)
+	fmt.Fprintf(writer, "In-flight:\t%d\n", status.InFlight)
+	fmt.Fprintf(writer, "Retry queue:\t%d\n", status.RetryQueue)
+	fmt.Fprintf(writer, "Pending events:\t%d\n", status.PendingEvents)
+	writer.Flush()
+
+	names := []string{}
+	for name := range status.Components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(output)
+	writer = tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "COMPONENT\tHEALTHY\tSINCE\tDETAIL")
+	for _, name := range names {
+		health := status.Components[name]
+
+		detail := health.Detail
+		if !health.Healthy && len(health.LastError) > 0 {
+			detail = health.LastError
+		}
+
+		fmt.Fprintf(writer, "%s\t%t\t%s\t%s\n", name, health.Healthy, health.Since.Format(time.RFC3339), detail)
+	}
+	writer.Flush()
+
+	errors := status.Errors
+	if maxErrors >= 0 && len(errors) > maxErrors {
+		errors = errors[len(errors)-maxErrors:]
+	}
+
+	if len(errors) == 0 {
+		return
+	}
+
+	fmt.Fprintln(output)
+	writer = tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "TIME\tFUNCTION\tERROR")
+	for _, recentError := range errors {
+		message := recentError.Message
+		if len(recentError.Error) > 0 {
+			message = fmt.Sprintf("%s - %s", message, recentError.Error)
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", recentError.Time.Format(time.RFC3339), recentError.Function, message)
+	}
+	writer.Flush()
+}
+
+// stopMain stops the running daemon
+func stopMain(args []string) {
+	logger := log.WithFields(log.Fields{
+		"package":  "main",
+		"function": "stopMain",
+	})
+
+	var help bool
+	var verbose bool
+	var configFilePath string
+	var socketPath string
+
+	flags := newControlFlagSet(StopCommand, "Stops the running daemon.", &help, &verbose, &configFilePath, &socketPath)
+	flags.Parse(args)
+
+	if help {
+		flags.Usage()
+		os.Exit(0)
+	}
+
+	log.SetOutput(os.Stderr)
+	if !verbose {
+		log.SetLevel(log.WarnLevel)
+	}
+
+	socketPath, err := resolveControlSocketPath(configFilePath, socketPath)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to find the control socket")
+	}
+
+	_, err = purgeman.SendControlRequest(socketPath, &purgeman.ControlRequest{
+		Command: purgeman.ControlCommandStop,
+	})
+	if err != nil {
+		logger.WithError(err).Fatal("failed to stop purgeman")
+	}
+
+	fmt.Println("Purgeman is stopped")
+	os.Exit(0)
+}
+
+// reloadMain makes the running daemon restart its service with the config given
+func reloadMain(args []string) {
+	logger := log.WithFields(log.Fields{
+		"package":  "main",
+		"function": "reloadMain",
+	})
+
+	var help bool
+	var verbose bool
+	var configFilePath string
+	var socketPath string
+
+	flags := newControlFlagSet(ReloadCommand, "Restarts the service of the running daemon with the config given, events waiting for retry are dropped.", &help, &verbose, &configFilePath, &socketPath)
+	flags.Parse(args)
+
+	if help {
+		flags.Usage()
+		os.Exit(0)
+	}
+
+	log.SetOutput(os.Stderr)
+	if !verbose {
+		log.SetLevel(log.WarnLevel)
+	}
+
+	config, stdinClosed, err := loadConfig(commons.NewDefaultConfig(), configFilePath)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to read configuration")
+	}
+
+	if len(config.ReplayCapturePath) > 0 {
+		// AMQP is not used
+		err = inputMissingIRODSParams(config, stdinClosed)
+	} else {
+		err = inputMissingParams(config, stdinClosed)
+	}
+	if err != nil {
+		logger.WithError(err).Fatal("Could not input missing parameters")
+	}
+
+	err = config.Validate()
+	if err != nil {
+		logger.WithError(err).Fatal("invalid configuration")
+	}
+
+	if len(socketPath) == 0 {
+		socketPath = config.ControlSocketPath
+	}
+
+	if len(socketPath) == 0 {
+		logger.Fatal("control socket is disabled, set control_socket_path or give -socket")
+	}
+
+	configBytes, err := yaml.Marshal(config)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to serialize configuration")
+	}
+
+	response, err := purgeman.SendControlRequest(socketPath, &purgeman.ControlRequest{
+		Command: purgeman.ControlCommandReload,
+		Config:  string(configBytes),
+	})
+	if err != nil {
+		logger.WithError(err).Fatal("failed to reload purgeman")
+	}
+
+	for _, warning := range response.Warnings {
+		fmt.Printf("WARN: %s\n", warning)
+	}
+
+	fmt.Println("Purgeman is reloaded")
+	os.Exit(0)
+}
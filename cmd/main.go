@@ -33,6 +33,33 @@ func (w *NilWriter) Write(p []byte) (n int, err error) {
 }
 
 func main() {
+	// subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case PurgeCommand:
+			purgeMain(os.Args[2:])
+			return
+		case ReplayCommand:
+			replayMain(os.Args[2:])
+			return
+		case CheckCommand:
+			checkMain(os.Args[2:])
+			return
+		case SelftestCommand:
+			selftestMain(os.Args[2:])
+			return
+		case StatusCommand:
+			statusMain(os.Args[2:])
+			return
+		case StopCommand:
+			stopMain(os.Args[2:])
+			return
+		case ReloadCommand:
+			reloadMain(os.Args[2:])
+			return
+		}
+	}
+
 	// check if this is subprocess running in the background
 	isChildProc := false
 
@@ -258,6 +285,10 @@ func run(config *commons.Config, isChildProcess bool) error {
 		"function": "run",
 	})
 
+	// keep recent errors for the status
+	recentErrors := purgeman.NewRecentErrors(purgeman.RecentErrorsSize)
+	log.AddHook(recentErrors)
+
 	// run a service
 	svc, err := purgeman.NewPurgeman(config)
 	if err != nil {
@@ -268,6 +299,23 @@ func run(config *commons.Config, isChildProcess bool) error {
 		return err
 	}
 
+	controller := newDaemonController(svc, recentErrors)
+
+	var controlServer *purgeman.ControlServer
+	if len(config.ControlSocketPath) > 0 && config.DryRun {
+		// the socket belongs to the service running with the same config
+		logger.Warnf("Ignoring control socket %s in dry-run mode", config.ControlSocketPath)
+	} else if len(config.ControlSocketPath) > 0 {
+		controlServer, err = purgeman.NewControlServer(config.ControlSocketPath, controller.handle)
+		if err != nil {
+			// the service works without the control socket
+			logger.WithError(err).Error("failed to listen on the control socket, status, stop and reload commands are not available")
+		} else {
+			go controlServer.Serve()
+			defer controlServer.Close()
+		}
+	}
+
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL, syscall.SIGQUIT)
 
@@ -279,7 +327,10 @@ func run(config *commons.Config, isChildProcess bool) error {
 			fmt.Fprintln(os.Stderr, InterProcessCommunicationFinishError)
 		}
 
-		svc.Destroy()
+		controller.stop()
+		if controlServer != nil {
+			controlServer.Close()
+		}
 		os.Exit(0)
 	}()
 
@@ -292,14 +343,24 @@ func run(config *commons.Config, isChildProcess bool) error {
 		}
 	}
 
-	err = svc.Start()
-	if err != nil {
-		logger.WithError(err).Error("failed to start the service, terminating Purgeman")
-		svc.Destroy()
-		return err
+	for {
+		err = svc.Start()
+		if err != nil {
+			logger.WithError(err).Error("failed to start the service, terminating Purgeman")
+			svc.Destroy()
+			return err
+		}
+
+		// returns if fails, or stopped. the service is replaced on reloads
+		next := controller.takeNext()
+		if next == nil {
+			break
+		}
+
+		logger.Info("Service stopped, starting a service reloaded")
+		svc = next
 	}
 
-	// returns if fails, or stopped.
 	logger.Info("Service stopped, terminating Purgeman")
 	svc.Destroy()
 	return nil
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+	"github.com/cyverse/purgeman/pkg/purgeman"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// PurgeCommand is a subcommand that purges caches for iRODS paths given and exits
+	PurgeCommand = "purge"
+)
+
+// purgeMain purges caches for iRODS paths given in arguments or STDIN without connecting to AMQP
+func purgeMain(args []string) {
+	logger := log.WithFields(log.Fields{
+		"package":  "main",
+		"function": "purgeMain",
+	})
+
+	var help bool
+	var verbose bool
+	var configFilePath string
+	var eventType string
+	var subtree bool
+	var dryRun bool
+
+	flags := flag.NewFlagSet(PurgeCommand, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [options] <irods-path>...\n", os.Args[0], PurgeCommand)
+		fmt.Fprintln(flags.Output(), "Paths are read from STDIN, one per line, if no path or \"-\" is given.")
+		flags.PrintDefaults()
+	}
+
+	flags.BoolVar(&help, "h", false, "Print help")
+	flags.BoolVar(&verbose, "verbose", false, "Print informational logs")
+	flags.StringVar(&configFilePath, "config", "", "Set Config YAML File")
+	flags.StringVar(&eventType, "event", "", "Purge as policy rules decide for the event type, e.g., data-object.rm")
+	flags.BoolVar(&subtree, "subtree", false, "Purge everything under the paths")
+	flags.BoolVar(&dryRun, "dry-run", false, "Print planned purge requests without sending them")
+
+	flags.Parse(args)
+
+	if help {
+		flags.Usage()
+		os.Exit(0)
+	}
+
+	log.SetOutput(os.Stderr)
+	if !verbose {
+		log.SetLevel(log.WarnLevel)
+	}
+
+	if len(eventType) > 0 {
+		if subtree {
+			logger.Fatal("-subtree cannot be used with -event, policy rules decide what to purge")
+		}
+
+		if !purgeman.IsFSEventType(eventType) {
+			logger.Fatalf("unknown event type %s", eventType)
+		}
+	}
+
+	readStdin := flags.NArg() == 0 || (flags.NArg() == 1 && flags.Arg(0) == "-")
+	if readStdin && configFilePath == "-" {
+		logger.Fatal("paths cannot be read from STDIN when the config is given via STDIN")
+	}
+
+	config, stdinClosed, err := loadConfig(commons.NewDefaultConfig(), configFilePath)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to read configuration")
+	}
+
+	var irodsPaths []string
+	if readStdin {
+		irodsPaths, err = readPurgePaths(os.Stdin)
+		if err != nil {
+			logger.WithError(err).Fatal("failed to read paths from STDIN")
+		}
+		stdinClosed = true
+	} else {
+		irodsPaths = flags.Args()
+	}
+
+	for idx, irodsPath := range irodsPaths {
+		if !strings.HasPrefix(irodsPath, "/") {
+			logger.Fatalf("iRODS path %s is not absolute", irodsPath)
+		}
+		irodsPaths[idx] = path.Clean(irodsPath)
+	}
+
+	if len(irodsPaths) == 0 {
+		logger.Fatal("no paths to purge")
+	}
+
+	if dryRun {
+		config.DryRun = true
+	}
+
+	if config.DryRun && len(config.DryRunPath) == 0 {
+		// print plans rather than logging them
+		config.DryRunPath = "-"
+	}
+
+	// AMQP settings are not used, iRODS credentials are checked only when they are used
+	err = config.ValidateWithoutCredentials()
+	if err != nil {
+		logger.WithError(err).Fatal("invalid configuration")
+	}
+
+	if config.RequiresIRODSCredentials() {
+		err = inputMissingIRODSParams(config, stdinClosed)
+		if err != nil {
+			logger.WithError(err).Fatal("Could not input missing parameters")
+		}
+
+		err = config.ValidateIRODSCredentials()
+		if err != nil {
+			logger.WithError(err).Fatal("invalid configuration")
+		}
+	}
+
+	ignoreDaemonFiles(config)
+	svc, err := purgeman.NewPurgeman(config)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to create the service")
+	}
+
+	if config.RequiresIRODSLookups() {
+		// lookups fail open as the service does, so purges are still sent
+		err = svc.ConnectIRODS()
+		if err != nil {
+			logger.WithError(err).Warn("Failed to connect to iRODS, AVU policies and ACLs are not checked")
+		}
+	}
+
+	failed := printPurgeResults(os.Stdout, svc, irodsPaths, subtree, eventType, config.DryRun)
+	svc.Destroy()
+
+	if failed > 0 {
+		logger.Errorf("Failed to purge %d caches", failed)
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+// readPurgePaths reads iRODS paths, one per line, empty lines and lines starting with # are ignored
+func readPurgePaths(reader io.Reader) ([]string, error) {
+	irodsPaths := []string{}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		irodsPaths = append(irodsPaths, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return irodsPaths, nil
+}
+
+// printPurgeResults purges the paths and prints a result for each target, returns the number of failures
+func printPurgeResults(output io.Writer, svc *purgeman.PurgemanService, irodsPaths []string, subtree bool, eventType string, dryRun bool) int {
+	writer := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "TARGET\tPATH\tRESULT")
+
+	failed := 0
+	for _, irodsPath := range irodsPaths {
+		results := svc.PurgePaths([]string{irodsPath}, subtree, eventType)
+		if len(results) == 0 {
+			fmt.Fprintf(writer, "-\t%s\tnothing to purge\n", irodsPath)
+			continue
+		}
+
+		for _, result := range results {
+			resultPath := result.Path
+			if result.Subtree {
+				resultPath += " (subtree)"
+			}
+
+			status := "purged"
+			if dryRun {
+				status = "planned"
+			}
+			if len(result.Error) > 0 {
+				status = fmt.Sprintf("failed - %s", result.Error)
+				failed++
+			} else if len(result.Skipped) > 0 {
+				status = fmt.Sprintf("skipped - %s", result.Skipped)
+			}
+
+			fmt.Fprintf(writer, "%s\t%s\t%s\n", result.Target, resultPath, status)
+		}
+	}
+
+	writer.Flush()
+	return failed
+}
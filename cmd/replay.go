@@ -0,0 +1,215 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+	"github.com/cyverse/purgeman/pkg/purgeman"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ReplayCommand is a subcommand that re-issues purges recorded in audit journals and exits
+	ReplayCommand = "replay"
+)
+
+// replayMain re-issues purges recorded in audit journals given in arguments
+func replayMain(args []string) {
+	logger := log.WithFields(log.Fields{
+		"package":  "main",
+		"function": "replayMain",
+	})
+
+	var help bool
+	var verbose bool
+	var configFilePath string
+	var since string
+	var until string
+	var pathPrefix string
+	var dryRun bool
+
+	flags := flag.NewFlagSet(ReplayCommand, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [options] <journal>...\n", os.Args[0], ReplayCommand)
+		fmt.Fprintln(flags.Output(), "Times are given in RFC3339, e.g., 2021-01-02T15:04:05Z, or as a duration before now, e.g., 2h.")
+		flags.PrintDefaults()
+	}
+
+	flags.BoolVar(&help, "h", false, "Print help")
+	flags.BoolVar(&verbose, "verbose", false, "Print informational logs")
+	flags.StringVar(&configFilePath, "config", "", "Set Config YAML File")
+	flags.StringVar(&since, "since", "", "Replay purges recorded at or after the time")
+	flags.StringVar(&until, "until", "", "Replay purges recorded before the time")
+	flags.StringVar(&pathPrefix, "path-prefix", "", "Replay purges for paths under the collection")
+	flags.BoolVar(&dryRun, "dry-run", false, "Print purge requests without sending them")
+
+	flags.Parse(args)
+
+	if help {
+		flags.Usage()
+		os.Exit(0)
+	}
+
+	log.SetOutput(os.Stderr)
+	if !verbose {
+		log.SetLevel(log.WarnLevel)
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	now := time.Now()
+	filter := purgeman.AuditFilter{}
+
+	var err error
+	filter.Since, err = parseReplayTime(since, now)
+	if err != nil {
+		logger.WithError(err).Fatal("invalid -since")
+	}
+
+	filter.Until, err = parseReplayTime(until, now)
+	if err != nil {
+		logger.WithError(err).Fatal("invalid -until")
+	}
+
+	if len(pathPrefix) > 0 {
+		if !strings.HasPrefix(pathPrefix, "/") {
+			logger.Fatalf("path prefix %s is not absolute", pathPrefix)
+		}
+		filter.PathPrefix = path.Clean(pathPrefix)
+	}
+
+	replay := purgeman.NewAuditReplay(filter)
+	readsStdin := false
+	for _, journalPath := range flags.Args() {
+		if journalPath == "-" {
+			readsStdin = true
+		}
+
+		err = readReplayJournal(journalPath, replay)
+		if err != nil {
+			logger.WithError(err).Fatalf("failed to read audit journal %s", journalPath)
+		}
+	}
+
+	config, stdinClosed, err := loadConfig(commons.NewDefaultConfig(), configFilePath)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to read configuration")
+	}
+
+	if dryRun {
+		config.DryRun = true
+	}
+
+	if config.DryRun && len(config.DryRunPath) == 0 {
+		// print plans rather than logging them
+		config.DryRunPath = "-"
+	}
+
+	// AMQP settings are not used, and recorded purges are sent without looking up iRODS
+	err = config.ValidateWithoutCredentials()
+	if err != nil {
+		logger.WithError(err).Fatal("invalid configuration")
+	}
+
+	// targets may still authenticate with iRODS credentials
+	if config.RequiresIRODSCredentials() {
+		err = inputMissingIRODSParams(config, stdinClosed || readsStdin)
+		if err != nil {
+			logger.WithError(err).Fatal("Could not input missing parameters")
+		}
+
+		err = config.ValidateIRODSCredentials()
+		if err != nil {
+			logger.WithError(err).Fatal("invalid configuration")
+		}
+	}
+
+	ignoreDaemonFiles(config)
+	svc, err := purgeman.NewPurgeman(config)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to create the service")
+	}
+
+	if len(replay.Requests) == 0 {
+		logger.Warn("No purges to replay")
+	}
+
+	failed := printReplayResults(os.Stdout, svc.ReplayPurges(replay.Requests), config.DryRun)
+	svc.Destroy()
+
+	if failed > 0 {
+		logger.Errorf("Failed to replay %d purge requests", failed)
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+// parseReplayTime parses a time in RFC3339 or a duration before now, returns zero time if empty
+func parseReplayTime(value string, now time.Time) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+
+	duration, durationErr := time.ParseDuration(value)
+	if durationErr != nil {
+		return time.Time{}, fmt.Errorf("failed to parse %s as RFC3339 or a duration - %v", value, err)
+	}
+
+	return now.Add(-duration), nil
+}
+
+// readReplayJournal collects purges recorded in the audit journal file, "-" reads STDIN
+func readReplayJournal(journalPath string, replay *purgeman.AuditReplay) error {
+	var reader io.Reader = os.Stdin
+	if journalPath != "-" {
+		file, err := os.Open(journalPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		reader = file
+	}
+
+	return purgeman.ReadAuditJournal(reader, replay.Add)
+}
+
+// printReplayResults prints a result for each purge request, returns the number of failures
+func printReplayResults(output io.Writer, results []*purgeman.ReplayResult, dryRun bool) int {
+	writer := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "TARGET\tMETHOD\tURL\tRESULT")
+
+	failed := 0
+	for _, result := range results {
+		status := "purged"
+		if dryRun {
+			status = "planned"
+		}
+
+		if len(result.Result.Error) > 0 {
+			status = fmt.Sprintf("failed - %s", result.Result.Error)
+			failed++
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", result.Target, result.Result.Method, result.Result.URL, status)
+	}
+
+	writer.Flush()
+	return failed
+}
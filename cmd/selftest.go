@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+	"github.com/cyverse/purgeman/pkg/purgeman"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// SelftestCommand is a subcommand that publishes a canary and confirms the running daemon purges it
+	SelftestCommand = "selftest"
+	// selftestPollInterval is an interval to look up the canary
+	selftestPollInterval = 200 * time.Millisecond
+)
+
+// canaryFinder looks up the canary handled by the running daemon
+type canaryFinder func(id string) (*purgeman.CanaryRecord, bool, error)
+
+// selftestMain publishes a canary, confirms the running daemon purged it via the admin API or the audit journal,
+// and reports the end-to-end latency
+func selftestMain(args []string) {
+	logger := log.WithFields(log.Fields{
+		"package":  "main",
+		"function": "selftestMain",
+	})
+
+	var help bool
+	var verbose bool
+	var configFilePath string
+	var timeout time.Duration
+
+	flags := flag.NewFlagSet(SelftestCommand, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [options]\n", os.Args[0], SelftestCommand)
+		fmt.Fprintln(flags.Output(), "The daemon must run with the same config, having the admin API or the audit journal enabled.")
+		flags.PrintDefaults()
+	}
+
+	flags.BoolVar(&help, "h", false, "Print help")
+	flags.BoolVar(&verbose, "verbose", false, "Print informational logs")
+	flags.StringVar(&configFilePath, "config", "", "Set Config YAML File")
+	flags.DurationVar(&timeout, "timeout", 0, "Set time to wait for the purge (default: canary timeout in config)")
+
+	flags.Parse(args)
+
+	if help {
+		flags.Usage()
+		os.Exit(0)
+	}
+
+	log.SetOutput(os.Stderr)
+	if !verbose {
+		log.SetLevel(log.WarnLevel)
+	}
+
+	config, stdinClosed, err := loadConfig(commons.NewDefaultConfig(), configFilePath)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to read configuration")
+	}
+
+	err = inputMissingParams(config, stdinClosed)
+	if err != nil {
+		logger.WithError(err).Fatal("Could not input missing parameters")
+	}
+
+	err = config.Validate()
+	if err != nil {
+		logger.WithError(err).Fatal("invalid configuration")
+	}
+
+	if len(config.CanaryPath) == 0 {
+		logger.Fatal("canary path must be given")
+	}
+
+	if timeout <= 0 {
+		timeout = config.CanaryTimeout
+	}
+
+	var finder canaryFinder
+	if len(config.HTTPListen) > 0 && len(config.AdminToken) > 0 {
+		finder = newAdminCanaryFinder(config)
+	} else if len(config.AuditJournalPath) > 0 {
+		finder, err = newJournalCanaryFinder(config.AuditJournalPath)
+		if err != nil {
+			logger.WithError(err).Fatalf("failed to access the audit journal %s", config.AuditJournalPath)
+		}
+	} else {
+		logger.Fatal("either the admin API or the audit journal must be enabled to confirm purges")
+	}
+
+	id, publishTime, err := purgeman.PublishCanary(config)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to publish a canary")
+	}
+
+	fmt.Printf("Published canary %s for %s to exchange %s\n", id, config.CanaryPath, config.AMQPExchange)
+
+	var record *purgeman.CanaryRecord
+	var lastErr error
+	deadline := publishTime.Add(timeout)
+	for time.Now().Before(deadline) {
+		found := false
+		record, found, err = finder(id)
+		if err != nil {
+			lastErr = err
+		} else if found {
+			break
+		}
+
+		time.Sleep(selftestPollInterval)
+	}
+
+	if record == nil {
+		if lastErr != nil {
+			logger.WithError(lastErr).Error("Failed to look up the canary")
+		}
+		fmt.Printf("FAIL: canary %s is not handled in %s\n", id, timeout)
+		os.Exit(1)
+	}
+
+	if len(record.Skipped) > 0 {
+		fmt.Printf("FAIL: canary %s is skipped - %s\n", id, record.Skipped)
+		os.Exit(1)
+	}
+
+	failed := printCanaryResults(record)
+	latency := record.Time.Sub(publishTime)
+
+	if failed > 0 {
+		fmt.Printf("FAIL: %d purges failed, end-to-end latency %s\n", failed, latency)
+		os.Exit(1)
+	}
+
+	fmt.Printf("PASS: end-to-end latency %s\n", latency)
+	os.Exit(0)
+}
+
+// printCanaryResults prints a result for each target, returns the number of failures
+func printCanaryResults(record *purgeman.CanaryRecord) int {
+	failed := 0
+	for _, result := range record.Results {
+		status := "purged"
+		if len(result.Error) > 0 {
+			status = fmt.Sprintf("failed - %s", result.Error)
+			failed++
+		} else if len(result.Skipped) > 0 {
+			status = fmt.Sprintf("skipped - %s", result.Skipped)
+		}
+
+		fmt.Printf("  target %s, path %s: %s\n", result.Target, result.Path, status)
+	}
+	return failed
+}
+
+// newAdminCanaryFinder returns a finder looking up canaries via the admin API of the daemon
+func newAdminCanaryFinder(config *commons.Config) canaryFinder {
+	host, port, _ := net.SplitHostPort(config.HTTPListen)
+	if len(host) == 0 || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+
+	canaryURL := fmt.Sprintf("http://%s/admin/canary", net.JoinHostPort(host, port))
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+	}
+
+	return func(id string) (*purgeman.CanaryRecord, bool, error) {
+		req, err := http.NewRequest(http.MethodGet, canaryURL+"?id="+id, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		req.Header.Set("Authorization", "Bearer "+config.AdminToken)
+
+		response, err := client.Do(req)
+		if err != nil {
+			return nil, false, err
+		}
+		defer response.Body.Close()
+
+		switch response.StatusCode {
+		case http.StatusOK:
+			record := &purgeman.CanaryRecord{}
+			err = json.NewDecoder(response.Body).Decode(record)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to decode a canary - %v", err)
+			}
+			return record, true, nil
+		case http.StatusNotFound:
+			return nil, false, nil
+		default:
+			return nil, false, fmt.Errorf("unexpected response from %s - %s", canaryURL, response.Status)
+		}
+	}
+}
+
+// newJournalCanaryFinder returns a finder looking up canaries in entries appended to the audit journal from now
+func newJournalCanaryFinder(journalPath string) (canaryFinder, error) {
+	offset := int64(0)
+	fileinfo, err := os.Stat(journalPath)
+	if err == nil {
+		offset = fileinfo.Size()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return func(id string) (*purgeman.CanaryRecord, bool, error) {
+		file, err := os.Open(journalPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+		defer file.Close()
+
+		fileinfo, err := file.Stat()
+		if err != nil {
+			return nil, false, err
+		}
+
+		start := offset
+		if fileinfo.Size() < start {
+			// rotated
+			start = 0
+		}
+
+		_, err = file.Seek(start, 0)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return purgeman.FindCanaryInJournal(file, id)
+	}, nil
+}
@@ -6,6 +6,7 @@ require (
 	github.com/BurntSushi/toml v0.4.1 // indirect
 	github.com/cyverse/go-irodsclient v0.5.6
 	github.com/kelseyhightower/envconfig v1.4.0
+	github.com/prometheus/client_golang v1.11.1
 	github.com/rs/xid v1.3.0
 	github.com/sirupsen/logrus v1.8.1
 	github.com/streadway/amqp v1.0.0
@@ -2,16 +2,54 @@ package commons
 
 import (
 	"fmt"
+	"net"
+	"strings"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	yaml "gopkg.in/yaml.v2"
 )
 
 const (
-	AMQPPortDefault         int    = 5672
-	IRODSPortDefault        int    = 1247
-	VarnishURLPrefixDefault string = "http://127.0.0.1:6081/"
-	LogFilePathDefault      string = "/tmp/purgeman.log"
+	// ResolveStrategyMessage resolves a path carried in the message
+	ResolveStrategyMessage string = "message"
+	// ResolveStrategyUUID resolves a path by searching an UUID AVU
+	ResolveStrategyUUID string = "uuid"
+	// ResolveStrategyDataID resolves a path by searching a data object ID via GenQuery
+	ResolveStrategyDataID string = "data_id"
+)
+
+const (
+	AMQPPortDefault                 int     = 5672
+	IRODSPortDefault                int     = 1247
+	VarnishURLPrefixDefault         string  = "http://127.0.0.1:6081/"
+	UUIDAttributeDefault            string  = "ipc_UUID"
+	ResolveMessagePathFieldDefault  string  = "path"
+	ResolveDataIDFieldDefault       string  = "data_id"
+	EventTimestampFieldDefault      string  = "timestamp"
+	LogFilePathDefault              string  = "/tmp/purgeman.log"
+	RedactedValue                   string  = "<redacted>"
+	IRODSConnectionMaxDefault       int     = 10
+	IRODSOperationTimeoutDefault            = 5 * time.Minute
+	IRODSHealthCheckIntervalDefault         = 1 * time.Minute
+	IRODSReconnectIntervalDefault           = 1 * time.Minute
+	PendingBufferSizeDefault        int     = 10000
+	PendingSpillSizeDefault         int     = 1000000
+	UUIDCacheSizeDefault            int     = 10000
+	UUIDCacheTTLDefault                     = 1 * time.Hour
+	EventFilterUserFieldDefault     string  = "author.name"
+	AVUPolicyAttributeDefault       string  = "purgeman::policy"
+	AVUPolicyCacheSizeDefault       int     = 10000
+	AVUPolicyCacheTTLDefault                = 5 * time.Minute
+	ACLCacheSizeDefault             int     = 10000
+	ACLCacheTTLDefault                      = 1 * time.Minute
+	RetryAttemptsDefault            int     = 5
+	RetryDelayDefault                       = 30 * time.Second
+	RetryQueueSizeDefault           int     = 10000
+	AuditJournalMaxSizeDefault      int     = 100
+	AuditJournalMaxBackupsDefault   int     = 10
+	ReplaySpeedDefault              float64 = 1
+	CanaryTimeoutDefault                    = 1 * time.Minute
 )
 
 // Config holds the parameters list which can be configured
@@ -23,6 +61,9 @@ type Config struct {
 	AMQPQueue    string `envconfig:"PURGEMAN_AMQP_QUEUE" yaml:"amqp_queue"`
 	AMQPUsername string `envconfig:"PURGEMAN_AMQP_USERNAME" yaml:"amqp_username,omitempty"`
 	AMQPPassword string `envconfig:"PURGEMAN_AMQP_PASSWORD" yaml:"amqp_password,omitempty"`
+	// AMQPQueueExpiry is how long the queue declared is kept without consumers, e.g., while paused
+	// 0 declares an auto-delete queue, deleted as soon as it has no consumers
+	AMQPQueueExpiry time.Duration `envconfig:"PURGEMAN_AMQP_QUEUE_EXPIRY" yaml:"amqp_queue_expiry"`
 
 	IRODSHost     string `envconfig:"PURGEMAN_IRODS_HOST" yaml:"irods_host"`
 	IRODSPort     int    `envconfig:"PURGEMAN_IRODS_PORT" yaml:"irods_port"`
@@ -30,11 +71,104 @@ type Config struct {
 	IRODSPassword string `envconfig:"PURGEMAN_IRODS_PASSWORD" yaml:"irods_password,omitempty"`
 	IRODSZone     string `envconfig:"PURGEMAN_IRODS_ZONE" yaml:"irods_zone"`
 
-	VarnishHostsOverride []string `envconfig:"PURGEMAN_VARNISH_HOSTS_OVERRIDE" yaml:"varnish_hosts_override"`
-	VarnishURLPrefixes   []string `envconfig:"PURGEMAN_VARNISH_URLS" yaml:"varnish_urls"`
+	IRODSConnectionMax       int           `envconfig:"PURGEMAN_IRODS_CONNECTION_MAX" yaml:"irods_connection_max"`
+	IRODSOperationTimeout    time.Duration `envconfig:"PURGEMAN_IRODS_OPERATION_TIMEOUT" yaml:"irods_operation_timeout"`
+	IRODSHealthCheckInterval time.Duration `envconfig:"PURGEMAN_IRODS_HEALTH_CHECK_INTERVAL" yaml:"irods_health_check_interval"`
+	IRODSReconnectInterval   time.Duration `envconfig:"PURGEMAN_IRODS_RECONNECT_INTERVAL" yaml:"irods_reconnect_interval"`
+
+	Targets TargetConfigs `envconfig:"PURGEMAN_TARGETS" yaml:"targets,omitempty"`
+	// TargetProbeInterval is an interval of requests checking if targets are reachable, 0 to disable
+	// probes are purge requests for a path never cached, so they are disabled by default
+	TargetProbeInterval time.Duration `envconfig:"PURGEMAN_TARGET_PROBE_INTERVAL" yaml:"target_probe_interval"`
+
+	// EventFilters ignore events before any iRODS lookup or purge
+	EventFilters EventFilterRules `envconfig:"PURGEMAN_EVENT_FILTERS" yaml:"event_filters,omitempty"`
+	// IgnoreUsers ignore events made by the users, it is a shorthand of an event filter on author.name
+	IgnoreUsers []string `envconfig:"PURGEMAN_IGNORE_USERS" yaml:"ignore_users,omitempty"`
+
+	// PolicyRules decide what to purge for events, DefaultPolicyRules are used if empty
+	PolicyRules PolicyRules `envconfig:"PURGEMAN_POLICY_RULES" yaml:"policy_rules,omitempty"`
+
+	// AVUPolicy enables collection-level purge policies given in AVUs, inherited down the tree
+	// values are skip, subtree, ancestors or ancestors:N
+	AVUPolicy          bool          `envconfig:"PURGEMAN_AVU_POLICY" yaml:"avu_policy"`
+	AVUPolicyAttribute string        `envconfig:"PURGEMAN_AVU_POLICY_ATTRIBUTE" yaml:"avu_policy_attribute"`
+	AVUPolicyCacheSize int           `envconfig:"PURGEMAN_AVU_POLICY_CACHE_SIZE" yaml:"avu_policy_cache_size"`
+	AVUPolicyCacheTTL  time.Duration `envconfig:"PURGEMAN_AVU_POLICY_CACHE_TTL" yaml:"avu_policy_cache_ttl"`
+
+	// PathIncludes and PathExcludes filter paths of events, see CompilePathPattern for the syntax
+	PathIncludes []string `envconfig:"PURGEMAN_PATH_INCLUDES" yaml:"path_includes,omitempty"`
+	PathExcludes []string `envconfig:"PURGEMAN_PATH_EXCLUDES" yaml:"path_excludes,omitempty"`
+
+	// Deprecated: use Targets, these are migrated to Targets by MigrateLegacyTargets
+	VarnishHostsOverride []string `envconfig:"PURGEMAN_VARNISH_HOSTS_OVERRIDE" yaml:"varnish_hosts_override,omitempty"`
+	VarnishURLPrefixes   []string `envconfig:"PURGEMAN_VARNISH_URLS" yaml:"varnish_urls,omitempty"`
+
+	UUIDAttribute           string   `envconfig:"PURGEMAN_UUID_ATTRIBUTE" yaml:"uuid_attribute"`
+	ResolveStrategies       []string `envconfig:"PURGEMAN_RESOLVE_STRATEGIES" yaml:"resolve_strategies"`
+	ResolveMessagePathField string   `envconfig:"PURGEMAN_RESOLVE_MESSAGE_PATH_FIELD" yaml:"resolve_message_path_field"`
+	ResolveDataIDField      string   `envconfig:"PURGEMAN_RESOLVE_DATA_ID_FIELD" yaml:"resolve_data_id_field"`
+
+	// EventTimestampField is a field of message body having the time of the event, the delivery timestamp is used if not given
+	EventTimestampField string `envconfig:"PURGEMAN_EVENT_TIMESTAMP_FIELD" yaml:"event_timestamp_field"`
+
+	UUIDCacheSize int           `envconfig:"PURGEMAN_UUID_CACHE_SIZE" yaml:"uuid_cache_size"`
+	UUIDCacheTTL  time.Duration `envconfig:"PURGEMAN_UUID_CACHE_TTL" yaml:"uuid_cache_ttl"`
+
+	// ACLCheck enables checking ACLs of paths before purging targets marked anonymous
+	ACLCheck       bool          `envconfig:"PURGEMAN_ACL_CHECK" yaml:"acl_check"`
+	ACLCacheSize   int           `envconfig:"PURGEMAN_ACL_CACHE_SIZE" yaml:"acl_cache_size"`
+	ACLCacheTTL    time.Duration `envconfig:"PURGEMAN_ACL_CACHE_TTL" yaml:"acl_cache_ttl"`
+	AnonymousUsers []string      `envconfig:"PURGEMAN_ANONYMOUS_USERS" yaml:"anonymous_users"`
+
+	RetryAttempts  int           `envconfig:"PURGEMAN_RETRY_ATTEMPTS" yaml:"retry_attempts"`
+	RetryDelay     time.Duration `envconfig:"PURGEMAN_RETRY_DELAY" yaml:"retry_delay"`
+	RetryQueueSize int           `envconfig:"PURGEMAN_RETRY_QUEUE_SIZE" yaml:"retry_queue_size"`
+	DeadLetterPath string        `envconfig:"PURGEMAN_DEAD_LETTER_PATH" yaml:"dead_letter_path,omitempty"`
+
+	PendingBufferSize int    `envconfig:"PURGEMAN_PENDING_BUFFER_SIZE" yaml:"pending_buffer_size"`
+	PendingSpillPath  string `envconfig:"PURGEMAN_PENDING_SPILL_PATH" yaml:"pending_spill_path,omitempty"`
+	PendingSpillSize  int    `envconfig:"PURGEMAN_PENDING_SPILL_SIZE" yaml:"pending_spill_size"`
+
+	// HTTPListen is an address of the HTTP listener serving metrics and health endpoints, e.g., ":9090", disabled if empty
+	HTTPListen string `envconfig:"PURGEMAN_HTTP_LISTEN" yaml:"http_listen,omitempty"`
+
+	// AdminToken enables the admin API on the HTTP listener, requests must give it as a bearer token
+	AdminToken string `envconfig:"PURGEMAN_ADMIN_TOKEN" yaml:"admin_token,omitempty"`
+
+	// AuditJournalPath is a file recording events and purge requests in JSON lines format, disabled if empty
+	// the file is rotated when it grows over AuditJournalMaxSize in megabytes
+	AuditJournalPath       string `envconfig:"PURGEMAN_AUDIT_JOURNAL_PATH" yaml:"audit_journal_path,omitempty"`
+	AuditJournalMaxSize    int    `envconfig:"PURGEMAN_AUDIT_JOURNAL_MAX_SIZE" yaml:"audit_journal_max_size"`
+	AuditJournalMaxBackups int    `envconfig:"PURGEMAN_AUDIT_JOURNAL_MAX_BACKUPS" yaml:"audit_journal_max_backups"`
+
+	// CapturePath is a file recording raw AMQP deliveries in JSON lines format for offline testing, disabled if empty
+	CapturePath string `envconfig:"PURGEMAN_CAPTURE_PATH" yaml:"capture_path,omitempty"`
+
+	// ReplayCapturePath makes purgeman read deliveries from a capture file instead of AMQP, and stop when all are replayed
+	// ReplaySpeed 1 replays at the original speed, 2 replays twice as fast, 0 replays without delays
+	ReplayCapturePath string  `envconfig:"PURGEMAN_REPLAY_CAPTURE_PATH" yaml:"replay_capture_path,omitempty"`
+	ReplaySpeed       float64 `envconfig:"PURGEMAN_REPLAY_SPEED" yaml:"replay_speed"`
+	// ReplaySequential handles replayed events one by one, they are handled concurrently as live deliveries otherwise
+	ReplaySequential bool `envconfig:"PURGEMAN_REPLAY_SEQUENTIAL" yaml:"replay_sequential,omitempty"`
+
+	// CanaryPath is an iRODS path of synthetic data-object.add events published to check the whole chain
+	// "purgeman selftest" publishes one, and a canary is published every CanaryInterval if it is given
+	CanaryPath     string        `envconfig:"PURGEMAN_CANARY_PATH" yaml:"canary_path,omitempty"`
+	CanaryInterval time.Duration `envconfig:"PURGEMAN_CANARY_INTERVAL" yaml:"canary_interval,omitempty"`
+	CanaryTimeout  time.Duration `envconfig:"PURGEMAN_CANARY_TIMEOUT" yaml:"canary_timeout"`
+
+	// DryRun makes purgeman consume events from its own queue and record planned purge requests without sending them
+	// planned requests are appended to DryRunPath in JSON lines format, written to stdout if it is "-", or logged if empty
+	DryRun     bool   `envconfig:"PURGEMAN_DRY_RUN" yaml:"dry_run,omitempty"`
+	DryRunPath string `envconfig:"PURGEMAN_DRY_RUN_PATH" yaml:"dry_run_path,omitempty"`
 
 	LogPath string `envconfig:"PURGEMAN_LOG_PATH" yaml:"log_path,omitempty"`
 
+	// ControlSocketPath is a Unix socket that "purgeman status", "stop" and "reload" talk to, disabled if empty
+	// only the owner of the daemon process can connect to it, put it in a directory only the owner can write, e.g., /run/purgeman
+	ControlSocketPath string `envconfig:"PURGEMAN_CONTROL_SOCKET_PATH" yaml:"control_socket_path,omitempty"`
+
 	Foreground   bool `yaml:"foreground,omitempty"`
 	ChildProcess bool `yaml:"childprocess,omitempty"`
 }
@@ -44,12 +178,48 @@ func NewDefaultConfig() *Config {
 	return &Config{
 		AMQPPort:  AMQPPortDefault,
 		IRODSPort: IRODSPortDefault,
-		VarnishHostsOverride: []string{
-			"",
-		},
-		VarnishURLPrefixes: []string{
-			VarnishURLPrefixDefault,
+
+		IRODSConnectionMax:       IRODSConnectionMaxDefault,
+		IRODSOperationTimeout:    IRODSOperationTimeoutDefault,
+		IRODSHealthCheckInterval: IRODSHealthCheckIntervalDefault,
+		IRODSReconnectInterval:   IRODSReconnectIntervalDefault,
+
+		UUIDAttribute: UUIDAttributeDefault,
+		ResolveStrategies: []string{
+			ResolveStrategyMessage,
+			ResolveStrategyUUID,
 		},
+		ResolveMessagePathField: ResolveMessagePathFieldDefault,
+		ResolveDataIDField:      ResolveDataIDFieldDefault,
+
+		EventTimestampField: EventTimestampFieldDefault,
+
+		UUIDCacheSize: UUIDCacheSizeDefault,
+		UUIDCacheTTL:  UUIDCacheTTLDefault,
+
+		AVUPolicy:          false,
+		AVUPolicyAttribute: AVUPolicyAttributeDefault,
+		AVUPolicyCacheSize: AVUPolicyCacheSizeDefault,
+		AVUPolicyCacheTTL:  AVUPolicyCacheTTLDefault,
+
+		ACLCheck:       false,
+		ACLCacheSize:   ACLCacheSizeDefault,
+		ACLCacheTTL:    ACLCacheTTLDefault,
+		AnonymousUsers: []string{"anonymous", "public"},
+
+		RetryAttempts:  RetryAttemptsDefault,
+		RetryDelay:     RetryDelayDefault,
+		RetryQueueSize: RetryQueueSizeDefault,
+
+		PendingBufferSize: PendingBufferSizeDefault,
+		PendingSpillSize:  PendingSpillSizeDefault,
+
+		AuditJournalMaxSize:    AuditJournalMaxSizeDefault,
+		AuditJournalMaxBackups: AuditJournalMaxBackupsDefault,
+
+		ReplaySpeed: ReplaySpeedDefault,
+
+		CanaryTimeout: CanaryTimeoutDefault,
 
 		LogPath: LogFilePathDefault,
 
@@ -60,58 +230,43 @@ func NewDefaultConfig() *Config {
 
 // NewConfigFromENV creates Config from Environmental Variables
 func NewConfigFromENV() (*Config, error) {
-	config := Config{
-		AMQPPort:  AMQPPortDefault,
-		IRODSPort: IRODSPortDefault,
-		VarnishHostsOverride: []string{
-			"",
-		},
-		VarnishURLPrefixes: []string{
-			VarnishURLPrefixDefault,
-		},
-
-		LogPath: LogFilePathDefault,
+	config := NewDefaultConfig()
 
-		Foreground:   false,
-		ChildProcess: false,
-	}
-
-	err := envconfig.Process("", &config)
+	err := envconfig.Process("", config)
 	if err != nil {
 		return nil, fmt.Errorf("Env Read Error - %v", err)
 	}
 
-	return &config, nil
+	return config, nil
 }
 
 // NewConfigFromYAML creates Config from YAML
 func NewConfigFromYAML(yamlBytes []byte) (*Config, error) {
-	config := Config{
-		AMQPPort:  AMQPPortDefault,
-		IRODSPort: IRODSPortDefault,
-		VarnishHostsOverride: []string{
-			"",
-		},
-		VarnishURLPrefixes: []string{
-			VarnishURLPrefixDefault,
-		},
+	config := NewDefaultConfig()
 
-		LogPath: LogFilePathDefault,
-
-		Foreground:   false,
-		ChildProcess: false,
-	}
-
-	err := yaml.Unmarshal(yamlBytes, &config)
+	err := yaml.Unmarshal(yamlBytes, config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal YAML - %v", err)
 	}
 
-	return &config, nil
+	return config, nil
 }
 
 // Validate validates configuration
 func (config *Config) Validate() error {
+	// AMQP is not used when replaying a capture file
+	if len(config.ReplayCapturePath) == 0 {
+		err := config.validateAMQP()
+		if err != nil {
+			return err
+		}
+	}
+
+	return config.ValidateWithoutAMQP()
+}
+
+// validateAMQP validates AMQP settings
+func (config *Config) validateAMQP() error {
 	if len(config.AMQPHost) == 0 {
 		return fmt.Errorf("AMQP hostname must be given")
 	}
@@ -128,6 +283,19 @@ func (config *Config) Validate() error {
 		return fmt.Errorf("either AMQP exchange or AMQP Queue must be given")
 	}
 
+	if config.CanaryInterval > 0 && len(config.AMQPExchange) == 0 {
+		return fmt.Errorf("AMQP exchange must be given to publish canaries")
+	}
+
+	if config.DryRun && len(config.AMQPExchange) == 0 {
+		// a shared queue must not be consumed in dry-run mode
+		return fmt.Errorf("AMQP exchange must be given to declare a queue in dry-run mode")
+	}
+
+	if config.AMQPQueueExpiry < 0 {
+		return fmt.Errorf("AMQP queue expiry must not be negative")
+	}
+
 	if len(config.AMQPUsername) == 0 {
 		return fmt.Errorf("AMQP username must be given")
 	}
@@ -136,14 +304,23 @@ func (config *Config) Validate() error {
 		return fmt.Errorf("AMQP password must be given")
 	}
 
-	if len(config.IRODSHost) == 0 {
-		return fmt.Errorf("IRODS hostname must be given")
-	}
+	return nil
+}
 
-	if config.IRODSPort <= 0 {
-		return fmt.Errorf("IRODS port must be given")
+// ValidateWithoutAMQP validates configuration except AMQP settings
+// this is used by commands that do not consume messages
+func (config *Config) ValidateWithoutAMQP() error {
+	err := config.ValidateIRODSCredentials()
+	if err != nil {
+		return err
 	}
 
+	return config.ValidateWithoutCredentials()
+}
+
+// ValidateIRODSCredentials validates iRODS credentials
+// commands not always connecting to iRODS check them after prompting for missing ones
+func (config *Config) ValidateIRODSCredentials() error {
 	if len(config.IRODSUsername) == 0 {
 		return fmt.Errorf("IRODS username must be given")
 	}
@@ -152,13 +329,357 @@ func (config *Config) Validate() error {
 		return fmt.Errorf("IRODS password must be given")
 	}
 
+	return nil
+}
+
+// RequiresIRODSLookups returns true if purging paths looks up AVUs or ACLs in iRODS
+func (config *Config) RequiresIRODSLookups() bool {
+	if config.AVUPolicy {
+		return true
+	}
+
+	if config.ACLCheck {
+		for _, target := range config.Targets {
+			if target.Anonymous {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RequiresIRODSCredentials returns true if purging paths needs iRODS credentials
+// targets authenticating with iRODS credentials send them in requests, even when iRODS is not looked up
+func (config *Config) RequiresIRODSCredentials() bool {
+	if config.RequiresIRODSLookups() {
+		return true
+	}
+
+	for _, target := range config.Targets {
+		if target.GetAuthType() == TargetAuthIRODS {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateWithoutCredentials validates configuration except AMQP settings and iRODS credentials
+// this is used by commands that do not consume messages and connect to iRODS only when needed
+func (config *Config) ValidateWithoutCredentials() error {
+	if len(config.IRODSHost) == 0 {
+		return fmt.Errorf("IRODS hostname must be given")
+	}
+
+	if config.IRODSPort <= 0 {
+		return fmt.Errorf("IRODS port must be given")
+	}
+
 	if len(config.IRODSZone) == 0 {
 		return fmt.Errorf("IRODS zone must be given")
 	}
 
-	if len(config.VarnishURLPrefixes) == 0 {
-		return fmt.Errorf("Varnish URL Prefix is not given")
+	if config.IRODSConnectionMax <= 0 {
+		return fmt.Errorf("IRODS connection max must be greater than 0")
+	}
+
+	if config.IRODSOperationTimeout <= 0 {
+		return fmt.Errorf("IRODS operation timeout must be given")
+	}
+
+	if config.IRODSHealthCheckInterval <= 0 {
+		return fmt.Errorf("IRODS health check interval must be given")
+	}
+
+	if config.IRODSReconnectInterval <= 0 {
+		return fmt.Errorf("IRODS reconnect interval must be given")
+	}
+
+	if len(config.VarnishURLPrefixes) > 0 || len(config.VarnishHostsOverride) > 0 {
+		return fmt.Errorf("deprecated Varnish URL settings must be migrated to targets")
+	}
+
+	if len(config.Targets) == 0 {
+		return fmt.Errorf("at least one target must be given")
+	}
+
+	if config.TargetProbeInterval < 0 {
+		return fmt.Errorf("target probe interval must not be negative")
+	}
+
+	for idx, rule := range config.EventFilters {
+		err := rule.Validate()
+		if err != nil {
+			return fmt.Errorf("invalid event filter %d - %v", idx, err)
+		}
+	}
+
+	for idx, rule := range config.PolicyRules {
+		err := rule.Validate()
+		if err != nil {
+			return fmt.Errorf("invalid policy rule %d - %v", idx, err)
+		}
+	}
+
+	err := ValidatePathPatterns(config.PathIncludes)
+	if err != nil {
+		return fmt.Errorf("invalid path includes - %v", err)
+	}
+
+	err = ValidatePathPatterns(config.PathExcludes)
+	if err != nil {
+		return fmt.Errorf("invalid path excludes - %v", err)
+	}
+
+	targetNames := map[string]bool{}
+	for _, target := range config.Targets {
+		err := target.Validate()
+		if err != nil {
+			return err
+		}
+
+		if targetNames[target.Name] {
+			return fmt.Errorf("target name %s is duplicated", target.Name)
+		}
+		targetNames[target.Name] = true
+	}
+
+	if len(config.ResolveStrategies) == 0 {
+		return fmt.Errorf("at least one resolve strategy must be given")
+	}
+
+	for _, strategy := range config.ResolveStrategies {
+		switch strategy {
+		case ResolveStrategyMessage:
+			if len(config.ResolveMessagePathField) == 0 {
+				return fmt.Errorf("message path field must be given for resolve strategy %s", strategy)
+			}
+		case ResolveStrategyUUID:
+			if len(config.UUIDAttribute) == 0 {
+				return fmt.Errorf("UUID attribute must be given for resolve strategy %s", strategy)
+			}
+		case ResolveStrategyDataID:
+			if len(config.ResolveDataIDField) == 0 {
+				return fmt.Errorf("data ID field must be given for resolve strategy %s", strategy)
+			}
+		default:
+			return fmt.Errorf("unknown resolve strategy %s", strategy)
+		}
+	}
+
+	if config.UUIDCacheSize < 0 {
+		return fmt.Errorf("UUID cache size must not be negative")
+	}
+
+	if config.UUIDCacheSize > 0 && config.UUIDCacheTTL <= 0 {
+		return fmt.Errorf("UUID cache TTL must be given")
+	}
+
+	if config.AVUPolicy {
+		if len(config.AVUPolicyAttribute) == 0 {
+			return fmt.Errorf("AVU policy attribute must be given")
+		}
+
+		if config.AVUPolicyCacheSize < 0 {
+			return fmt.Errorf("AVU policy cache size must not be negative")
+		}
+
+		if config.AVUPolicyCacheSize > 0 && config.AVUPolicyCacheTTL <= 0 {
+			return fmt.Errorf("AVU policy cache TTL must be given")
+		}
+	}
+
+	if config.ACLCheck {
+		if len(config.AnonymousUsers) == 0 {
+			return fmt.Errorf("anonymous users must be given to check ACLs")
+		}
+
+		if config.ACLCacheSize < 0 {
+			return fmt.Errorf("ACL cache size must not be negative")
+		}
+
+		if config.ACLCacheSize > 0 && config.ACLCacheTTL <= 0 {
+			return fmt.Errorf("ACL cache TTL must be given")
+		}
+	}
+
+	if config.RetryAttempts < 0 {
+		return fmt.Errorf("retry attempts must not be negative")
+	}
+
+	if config.RetryAttempts > 0 && config.RetryDelay <= 0 {
+		return fmt.Errorf("retry delay must be given")
+	}
+
+	if config.PendingBufferSize < 0 {
+		return fmt.Errorf("pending buffer size must not be negative")
+	}
+
+	if config.PendingSpillSize < 0 {
+		return fmt.Errorf("pending spill size must not be negative")
+	}
+
+	if len(config.HTTPListen) > 0 {
+		_, _, err := net.SplitHostPort(config.HTTPListen)
+		if err != nil {
+			return fmt.Errorf("HTTP listen address must be host:port - %v", err)
+		}
+	}
+
+	if len(config.CanaryPath) > 0 && !strings.HasPrefix(config.CanaryPath, "/") {
+		return fmt.Errorf("canary path must be absolute")
+	}
+
+	if config.CanaryInterval < 0 {
+		return fmt.Errorf("canary interval must not be negative")
+	}
+
+	if config.CanaryInterval > 0 {
+		if len(config.CanaryPath) == 0 {
+			return fmt.Errorf("canary path must be given to publish canaries")
+		}
+
+		if config.CanaryTimeout <= 0 {
+			return fmt.Errorf("canary timeout must be given")
+		}
+	}
+
+	if config.ReplaySpeed < 0 {
+		return fmt.Errorf("replay speed must not be negative")
+	}
+
+	if len(config.AuditJournalPath) > 0 {
+		if config.AuditJournalMaxSize <= 0 {
+			return fmt.Errorf("audit journal max size must be given")
+		}
+
+		if config.AuditJournalMaxBackups < 0 {
+			return fmt.Errorf("audit journal max backups must not be negative")
+		}
 	}
 
 	return nil
 }
+
+// Warnings returns descriptions of settings that are valid but likely to be mistakes
+func (config *Config) Warnings() []string {
+	warnings := []string{}
+
+	hasAnonymousTarget := false
+	targetURLs := map[string]string{}
+	for _, target := range config.Targets {
+		if target.Anonymous {
+			hasAnonymousTarget = true
+
+			if !config.ACLCheck {
+				warnings = append(warnings, fmt.Sprintf("target %s is anonymous, but ACL check is disabled", target.Name))
+			}
+		}
+
+		key := fmt.Sprintf("%s %s %s", target.GetMethod(), target.URLPrefix, target.HostOverride)
+		if name, ok := targetURLs[key]; ok {
+			warnings = append(warnings, fmt.Sprintf("targets %s and %s send the same purge requests", name, target.Name))
+		} else {
+			targetURLs[key] = target.Name
+		}
+	}
+
+	if config.ACLCheck && !hasAnonymousTarget {
+		warnings = append(warnings, "ACL check is enabled, but no targets are anonymous")
+	}
+
+	if len(config.AdminToken) > 0 && len(config.HTTPListen) == 0 {
+		warnings = append(warnings, "admin token is given, but HTTP listener is disabled")
+	}
+
+	if len(config.AMQPQueue) > 0 {
+		warnings = append(warnings, fmt.Sprintf("AMQP queue %s is not consumed, a queue of the host is declared on the exchange", config.AMQPQueue))
+	}
+
+	if config.DryRun {
+		warnings = append(warnings, "dry-run mode is enabled, purge requests are not sent")
+
+		if len(config.DeadLetterPath) > 0 || len(config.PendingSpillPath) > 0 || len(config.CapturePath) > 0 || len(config.ControlSocketPath) > 0 {
+			warnings = append(warnings, "dead letter, pending spill, capture and control socket paths are ignored in dry-run mode")
+		}
+
+		if config.CanaryInterval > 0 {
+			warnings = append(warnings, "canaries are not published in dry-run mode")
+		}
+	}
+
+	if len(config.ReplayCapturePath) > 0 {
+		warnings = append(warnings, fmt.Sprintf("deliveries are replayed from %s instead of AMQP", config.ReplayCapturePath))
+	}
+
+	return warnings
+}
+
+// Redacted returns a copy of the config with secrets redacted
+func (config *Config) Redacted() *Config {
+	redacted := *config
+
+	redactString := func(value string) string {
+		if len(value) > 0 {
+			return RedactedValue
+		}
+		return value
+	}
+
+	redacted.AMQPPassword = redactString(config.AMQPPassword)
+	redacted.IRODSPassword = redactString(config.IRODSPassword)
+	redacted.AdminToken = redactString(config.AdminToken)
+
+	redacted.Targets = make(TargetConfigs, len(config.Targets))
+	for idx, target := range config.Targets {
+		target.Auth.Password = redactString(target.Auth.Password)
+		target.Auth.Token = redactString(target.Auth.Token)
+
+		// headers of variants may carry credentials, e.g., cookies or API keys
+		if len(target.Variants) > 0 {
+			variants := make([]URLVariant, len(target.Variants))
+			for variantIdx, variant := range target.Variants {
+				headers := map[string]string{}
+				for name, value := range variant.Headers {
+					headers[name] = redactString(value)
+				}
+				variant.Headers = headers
+				variants[variantIdx] = variant
+			}
+			target.Variants = variants
+		}
+
+		redacted.Targets[idx] = target
+	}
+
+	return &redacted
+}
+
+// GetEventFilters returns event filter rules including the rule made from IgnoreUsers
+func (config *Config) GetEventFilters() EventFilterRules {
+	rules := EventFilterRules{}
+	for idx, rule := range config.EventFilters {
+		if len(rule.Name) == 0 {
+			rule.Name = fmt.Sprintf("rule%d", idx)
+		}
+		rules = append(rules, rule)
+	}
+
+	for _, user := range config.IgnoreUsers {
+		rules = append(rules, EventFilterRule{
+			Name: fmt.Sprintf("user:%s", user),
+			Fields: map[string]string{
+				EventFilterUserFieldDefault: user,
+			},
+		})
+	}
+
+	return rules
+}
+
+// GetPolicyRules returns policy rules
+func (config *Config) GetPolicyRules() PolicyRules {
+	if len(config.PolicyRules) > 0 {
+		return config.PolicyRules
+	}
+	return DefaultPolicyRules()
+}
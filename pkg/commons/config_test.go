@@ -0,0 +1,217 @@
+package commons
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigValidateWithoutCredentials(t *testing.T) {
+	tests := []struct {
+		name           string
+		username       string
+		password       string
+		withoutCredErr bool
+		credErr        bool
+	}{
+		{"with credentials", "rods", "secret", false, false},
+		{"without username", "", "secret", false, true},
+		{"without password", "rods", "", false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := NewDefaultConfig()
+			config.IRODSHost = "data.cyverse.org"
+			config.IRODSZone = "iplant"
+			config.IRODSUsername = test.username
+			config.IRODSPassword = test.password
+			config.Targets = []TargetConfig{
+				{Name: "varnish", URLPrefix: "http://varnish.example.org"},
+			}
+
+			err := config.ValidateWithoutCredentials()
+			if (err != nil) != test.withoutCredErr {
+				t.Errorf("unexpected error from ValidateWithoutCredentials - %v", err)
+			}
+
+			err = config.ValidateIRODSCredentials()
+			if (err != nil) != test.credErr {
+				t.Errorf("unexpected error from ValidateIRODSCredentials - %v", err)
+			}
+
+			err = config.ValidateWithoutAMQP()
+			if (err != nil) != (test.withoutCredErr || test.credErr) {
+				t.Errorf("unexpected error from ValidateWithoutAMQP - %v", err)
+			}
+		})
+	}
+}
+
+func TestConfigRequiresIRODSCredentials(t *testing.T) {
+	tests := []struct {
+		name        string
+		modify      func(config *Config)
+		lookups     bool
+		credentials bool
+	}{
+		{
+			"default auth type of targets",
+			func(config *Config) {},
+			false,
+			true,
+		},
+		{
+			"targets without iRODS credentials",
+			func(config *Config) {
+				config.Targets[0].Auth.Type = TargetAuthNone
+			},
+			false,
+			false,
+		},
+		{
+			"AVU policies",
+			func(config *Config) {
+				config.Targets[0].Auth.Type = TargetAuthNone
+				config.AVUPolicy = true
+			},
+			true,
+			true,
+		},
+		{
+			"ACL checks for anonymous targets",
+			func(config *Config) {
+				config.Targets[0].Auth.Type = TargetAuthNone
+				config.Targets[0].Anonymous = true
+				config.ACLCheck = true
+			},
+			true,
+			true,
+		},
+		{
+			"ACL checks without anonymous targets",
+			func(config *Config) {
+				config.Targets[0].Auth.Type = TargetAuthNone
+				config.ACLCheck = true
+			},
+			false,
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := NewDefaultConfig()
+			config.Targets = []TargetConfig{
+				{Name: "varnish", URLPrefix: "http://varnish.example.org"},
+			}
+			test.modify(config)
+
+			if config.RequiresIRODSLookups() != test.lookups {
+				t.Errorf("expected RequiresIRODSLookups to be %t", test.lookups)
+			}
+
+			if config.RequiresIRODSCredentials() != test.credentials {
+				t.Errorf("expected RequiresIRODSCredentials to be %t", test.credentials)
+			}
+		})
+	}
+}
+
+func TestConfigRedacted(t *testing.T) {
+	config := NewDefaultConfig()
+	config.AMQPPassword = "amqp-secret"
+	config.IRODSPassword = "irods-secret"
+	config.AdminToken = "admin-secret"
+	config.Targets = []TargetConfig{
+		{
+			Name:      "varnish",
+			URLPrefix: "http://varnish.example.org",
+			Auth: TargetAuthConfig{
+				Type:  TargetAuthBearer,
+				Token: "bearer-secret",
+			},
+			Variants: []URLVariant{
+				{Suffix: "/"},
+				{
+					Query: "download=1",
+					Headers: map[string]string{
+						"Cookie":    "session=secret",
+						"X-Api-Key": "key-secret",
+					},
+				},
+			},
+		},
+	}
+
+	redacted := config.Redacted()
+
+	secrets := []string{
+		redacted.AMQPPassword,
+		redacted.IRODSPassword,
+		redacted.AdminToken,
+		redacted.Targets[0].Auth.Token,
+		redacted.Targets[0].Variants[1].Headers["Cookie"],
+		redacted.Targets[0].Variants[1].Headers["X-Api-Key"],
+	}
+	for _, secret := range secrets {
+		if secret != RedactedValue {
+			t.Errorf("expected %s to be redacted", secret)
+		}
+	}
+
+	if redacted.Targets[0].Variants[1].Query != "download=1" || redacted.Targets[0].Variants[0].Suffix != "/" {
+		t.Errorf("expected variants to be kept except header values, got %v", redacted.Targets[0].Variants)
+	}
+
+	// the config given is not changed
+	if config.Targets[0].Variants[1].Headers["Cookie"] != "session=secret" || config.Targets[0].Auth.Token != "bearer-secret" {
+		t.Error("expected the config given not to be redacted")
+	}
+}
+
+func TestConfigWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(config *Config)
+		expected string
+	}{
+		{"anonymous target without ACL check", func(config *Config) {
+			config.Targets = TargetConfigs{{Name: "public", URLPrefix: "http://127.0.0.1:6081/", Anonymous: true}}
+		}, "target public is anonymous, but ACL check is disabled"},
+		{"ACL check without anonymous targets", func(config *Config) {
+			config.ACLCheck = true
+			config.Targets = TargetConfigs{{Name: "private", URLPrefix: "http://127.0.0.1:6081/"}}
+		}, "no targets are anonymous"},
+		{"duplicate targets", func(config *Config) {
+			config.Targets = TargetConfigs{
+				{Name: "a", URLPrefix: "http://127.0.0.1:6081/"},
+				{Name: "b", URLPrefix: "http://127.0.0.1:6081/"},
+			}
+		}, "targets a and b send the same purge requests"},
+		{"admin token without HTTP listener", func(config *Config) {
+			config.AdminToken = "token"
+		}, "HTTP listener is disabled"},
+		{"dry run", func(config *Config) {
+			config.DryRun = true
+		}, "purge requests are not sent"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := NewDefaultConfig()
+			test.modify(config)
+
+			warnings := config.Warnings()
+			found := false
+			for _, warning := range warnings {
+				if strings.Contains(warning, test.expected) {
+					found = true
+				}
+			}
+
+			if !found {
+				t.Errorf("expected a warning %q, got %v", test.expected, warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package commons
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// EventFilterRule is a rule to ignore events, an event is ignored if all conditions match
+type EventFilterRule struct {
+	// Name is used to count ignored events, defaults to the index of the rule
+	Name string `yaml:"name,omitempty"`
+	// Events are event types, e.g., data-object.sys-metadata.mod, "*" matches any characters, empty matches all events
+	Events []string `yaml:"events,omitempty"`
+	// Fields map message fields to value patterns, nested fields are given with dots, e.g., author.name
+	// patterns are globs or regular expressions starting with "regex:"
+	Fields map[string]string `yaml:"fields,omitempty"`
+}
+
+// EventFilterRules is a list of event filter rules, it can be given via an environmental variable in YAML or JSON
+type EventFilterRules []EventFilterRule
+
+// Decode decodes EventFilterRules from an environmental variable
+func (rules *EventFilterRules) Decode(value string) error {
+	newRules := EventFilterRules{}
+	err := yaml.Unmarshal([]byte(value), &newRules)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal event filters - %v", err)
+	}
+
+	*rules = newRules
+	return nil
+}
+
+// Validate validates the event filter rule
+func (rule *EventFilterRule) Validate() error {
+	if len(rule.Events) == 0 && len(rule.Fields) == 0 {
+		return fmt.Errorf("events or fields must be given, otherwise all events are ignored")
+	}
+
+	for _, event := range rule.Events {
+		_, err := path.Match(event, "")
+		if err != nil {
+			return fmt.Errorf("invalid event pattern '%s' - %v", event, err)
+		}
+	}
+
+	for field, pattern := range rule.Fields {
+		if len(field) == 0 {
+			return fmt.Errorf("field name must be given")
+		}
+
+		_, err := CompileValuePattern(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern of field %s - %v", field, err)
+		}
+	}
+
+	return nil
+}
+
+// CompileValuePattern compiles a pattern of a message field value
+// patterns starting with "regex:" are regular expressions, others are globs where "*" matches any characters
+func CompileValuePattern(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, PathPatternRegexPrefix) {
+		regex, err := regexp.Compile(strings.TrimPrefix(pattern, PathPatternRegexPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile a pattern '%s' - %v", pattern, err)
+		}
+		return regex, nil
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("^")
+	for _, c := range pattern {
+		switch c {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+
+	return regexp.Compile(sb.String())
+}
@@ -0,0 +1,78 @@
+package commons
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// PathPatternRegexPrefix is a prefix of path patterns given in regular expression
+	PathPatternRegexPrefix string = "regex:"
+)
+
+// CompilePathPattern compiles a path pattern
+// patterns starting with "regex:" are regular expressions, others are globs
+// in globs, "*" and "?" do not match "/", "**" matches any number of path segments
+func CompilePathPattern(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, PathPatternRegexPrefix) {
+		regex, err := regexp.Compile(strings.TrimPrefix(pattern, PathPatternRegexPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile a path pattern '%s' - %v", pattern, err)
+		}
+		return regex, nil
+	}
+
+	if len(pattern) == 0 {
+		return nil, fmt.Errorf("empty path pattern")
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "/**/"):
+			// zero or more path segments
+			sb.WriteString("/(.*/)?")
+			i += 3
+		case strings.HasPrefix(pattern[i:], "/**") && i+3 == len(pattern):
+			// the path itself or anything under the path
+			sb.WriteString("(/.*)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		default:
+			// literals are copied rune by rune, so multi-byte characters are kept
+			_, size := utf8.DecodeRuneInString(pattern[i:])
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+size]))
+			i += size - 1
+		}
+	}
+
+	sb.WriteString("$")
+
+	regex, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile a path pattern '%s' - %v", pattern, err)
+	}
+	return regex, nil
+}
+
+// ValidatePathPatterns validates path patterns
+func ValidatePathPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		_, err := CompilePathPattern(pattern)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package commons
+
+import "testing"
+
+func TestCompilePathPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		matches []string
+		misses  []string
+	}{
+		{
+			"exact",
+			"/iplant/home/a.txt",
+			[]string{"/iplant/home/a.txt"},
+			[]string{"/iplant/home/aatxt", "/iplant/home/a.txt/b"},
+		},
+		{
+			"star within a segment",
+			"/iplant/home/*/public",
+			[]string{"/iplant/home/user/public", "/iplant/home//public"},
+			[]string{"/iplant/home/a/b/public", "/iplant/home/user/public/a.txt"},
+		},
+		{
+			"question mark",
+			"/iplant/home/user?",
+			[]string{"/iplant/home/user1"},
+			[]string{"/iplant/home/user", "/iplant/home/user/", "/iplant/home/user12"},
+		},
+		{
+			"trailing double star",
+			"/iplant/home/shared/**",
+			[]string{"/iplant/home/shared", "/iplant/home/shared/a", "/iplant/home/shared/a/b.txt"},
+			[]string{"/iplant/home/shared2", "/iplant/home"},
+		},
+		{
+			"double star segments",
+			"/iplant/**/trash/*",
+			[]string{"/iplant/trash/a", "/iplant/home/user/trash/a"},
+			[]string{"/iplant/home/trash", "/iplant/home/trash/a/b"},
+		},
+		{
+			"double star within a segment",
+			"/iplant/home/**.tmp",
+			[]string{"/iplant/home/a.tmp", "/iplant/home/a/b.tmp"},
+			[]string{"/iplant/home/a.tmp/b"},
+		},
+		{
+			"regex",
+			"regex:^/iplant/home/[^/]+/private(/.*)?$",
+			[]string{"/iplant/home/user/private", "/iplant/home/user/private/a.txt"},
+			[]string{"/iplant/home/user/privately", "/iplant/home/private"},
+		},
+		{
+			"regex metacharacters in globs",
+			"/iplant/home/a+b (1).txt",
+			[]string{"/iplant/home/a+b (1).txt"},
+			[]string{"/iplant/home/aab 1.txt"},
+		},
+		{
+			"non-ASCII globs",
+			"/zone/home/ü/**",
+			[]string{"/zone/home/ü", "/zone/home/ü/a.txt"},
+			[]string{"/zone/home/u/a.txt", "/zone/home/üx"},
+		},
+		{
+			"non-ASCII characters matched by ?",
+			"/zone/home/*/日本?.txt",
+			[]string{"/zone/home/ü/日本語.txt"},
+			[]string{"/zone/home/ü/日本.txt", "/zone/home/ü/日本語語.txt"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			regex, err := CompilePathPattern(test.pattern)
+			if err != nil {
+				t.Fatalf("failed to compile %s - %v", test.pattern, err)
+			}
+
+			for _, path := range test.matches {
+				if !regex.MatchString(path) {
+					t.Errorf("expected %s to match %s", path, test.pattern)
+				}
+			}
+
+			for _, path := range test.misses {
+				if regex.MatchString(path) {
+					t.Errorf("expected %s not to match %s", path, test.pattern)
+				}
+			}
+		})
+	}
+}
+
+func TestValidatePathPatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		valid    bool
+	}{
+		{"none", nil, true},
+		{"globs and regexes", []string{"/iplant/**", "regex:^/iplant/.*$"}, true},
+		{"empty glob", []string{"/iplant/**", ""}, false},
+		{"invalid regex", []string{"regex:("}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidatePathPatterns(test.patterns)
+			if (err == nil) != test.valid {
+				t.Errorf("expected valid %t, got %v", test.valid, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package commons
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// PurgeActionSelf purges the path
+	PurgeActionSelf string = "self"
+	// PurgeActionParent purges the parent collection
+	PurgeActionParent string = "parent"
+	// PurgeActionAncestors purges ancestor collections up to N levels, given as "ancestors:N"
+	PurgeActionAncestors string = "ancestors"
+	// PurgeActionSubtree purges the path and everything under the path
+	PurgeActionSubtree string = "subtree"
+	// PurgeActionTemplate purges a path made from a template, given as "template:{parent}/index.html"
+	// placeholders are {path}, {parent}, {basename}, {extension}, {uuid} and {zone}
+	PurgeActionTemplate string = "template"
+	// PurgeActionNone purges nothing
+	PurgeActionNone string = "none"
+)
+
+// PolicyRule is a rule that decides what to purge for an event
+// the first rule matching both event type and path is applied
+type PolicyRule struct {
+	// Events are event types, e.g., data-object.add, "*" matches any characters, empty matches all events
+	Events []string `yaml:"events,omitempty"`
+	// Path is a path pattern, see CompilePathPattern for the syntax, empty matches all paths
+	Path    string   `yaml:"path,omitempty"`
+	Actions []string `yaml:"actions"`
+}
+
+// PolicyRules is a list of policy rules, it can be given via an environmental variable in YAML or JSON
+type PolicyRules []PolicyRule
+
+// Decode decodes PolicyRules from an environmental variable
+func (rules *PolicyRules) Decode(value string) error {
+	newRules := PolicyRules{}
+	err := yaml.Unmarshal([]byte(value), &newRules)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal policy rules - %v", err)
+	}
+
+	*rules = newRules
+	return nil
+}
+
+// DefaultPolicyRules returns policy rules used when no rules are configured
+func DefaultPolicyRules() PolicyRules {
+	return PolicyRules{
+		{
+			// new entries only change the listing of the parent collection
+			Events:  []string{"data-object.add", "collection.add"},
+			Actions: []string{PurgeActionParent},
+		},
+		{
+			// mv events are applied to both old and new paths
+			// mod events also change the size shown in the listing of the parent collection
+			Events: []string{
+				"data-object.rm", "data-object.mv", "data-object.mod", "data-object.sys-metadata.mod",
+				"collection.rm", "collection.mv",
+			},
+			Actions: []string{PurgeActionParent, PurgeActionSelf},
+		},
+	}
+}
+
+// ParsePurgeAction parses a purge action and returns its type and argument
+func ParsePurgeAction(action string) (string, string, error) {
+	actionType := action
+	arg := ""
+	if idx := strings.Index(action, ":"); idx >= 0 {
+		actionType = action[:idx]
+		arg = action[idx+1:]
+	}
+
+	switch actionType {
+	case PurgeActionSelf, PurgeActionParent, PurgeActionSubtree, PurgeActionNone:
+		if len(arg) > 0 {
+			return "", "", fmt.Errorf("purge action %s does not take an argument", actionType)
+		}
+	case PurgeActionAncestors:
+		levels, err := strconv.Atoi(arg)
+		if err != nil || levels <= 0 {
+			return "", "", fmt.Errorf("purge action %s requires a positive number of levels, e.g., %s:2", actionType, actionType)
+		}
+	case PurgeActionTemplate:
+		if !strings.HasPrefix(arg, "/") && !strings.HasPrefix(arg, "{") {
+			return "", "", fmt.Errorf("purge action %s requires a template of an absolute path", actionType)
+		}
+	default:
+		return "", "", fmt.Errorf("unknown purge action %s", action)
+	}
+
+	return actionType, arg, nil
+}
+
+// Validate validates the policy rule
+func (rule *PolicyRule) Validate() error {
+	for _, event := range rule.Events {
+		_, err := path.Match(event, "")
+		if err != nil {
+			return fmt.Errorf("invalid event pattern '%s' - %v", event, err)
+		}
+	}
+
+	if len(rule.Path) > 0 {
+		_, err := CompilePathPattern(rule.Path)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(rule.Actions) == 0 {
+		return fmt.Errorf("actions must be given, use %s to purge nothing", PurgeActionNone)
+	}
+
+	for _, action := range rule.Actions {
+		_, _, err := ParsePurgeAction(action)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const (
+	// AVUPolicySkip purges nothing for paths under the collection
+	AVUPolicySkip string = "skip"
+)
+
+// ValidateAVUPolicy validates a purge policy given in an AVU, skip, subtree, ancestors or ancestors:N
+func ValidateAVUPolicy(policy string) error {
+	switch policy {
+	case AVUPolicySkip, PurgeActionSubtree, PurgeActionAncestors:
+		return nil
+	}
+
+	actionType, _, err := ParsePurgeAction(policy)
+	if err != nil || actionType != PurgeActionAncestors {
+		return fmt.Errorf("unknown AVU policy %s, must be %s, %s, %s or %s:N", policy, AVUPolicySkip, PurgeActionSubtree, PurgeActionAncestors, PurgeActionAncestors)
+	}
+	return nil
+}
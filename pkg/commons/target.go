@@ -0,0 +1,296 @@
+package commons
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// TargetBackendVarnish is a backend type for Varnish
+	TargetBackendVarnish string = "varnish"
+	// TargetBackendNginx is a backend type for Nginx with ngx_cache_purge, it responds 404 if nothing is cached
+	TargetBackendNginx string = "nginx"
+	// TargetBackendHTTP is a backend type for generic HTTP caches
+	TargetBackendHTTP string = "http"
+)
+
+const (
+	// TargetAuthIRODS sends iRODS username and password via basic auth
+	TargetAuthIRODS string = "irods"
+	// TargetAuthNone sends no credentials
+	TargetAuthNone string = "none"
+	// TargetAuthBasic sends given username and password via basic auth
+	TargetAuthBasic string = "basic"
+	// TargetAuthBearer sends given token via bearer auth
+	TargetAuthBearer string = "bearer"
+)
+
+const (
+	TargetMethodDefault         string = "PURGE"
+	TargetSubtreeMethodDefault  string = "BAN"
+	TargetTimeoutDefault               = 30 * time.Second
+	TargetConnectTimeoutDefault        = 10 * time.Second
+)
+
+// URLRewriteRule is a rule to rewrite an iRODS path before it is mapped to a purge URL
+// either Prefix or Regex must be given
+type URLRewriteRule struct {
+	Prefix  string `yaml:"prefix,omitempty"`
+	Regex   string `yaml:"regex,omitempty"`
+	Replace string `yaml:"replace"`
+}
+
+// URLVariant is a variant of a purge URL, a separate purge is sent for each variant
+type URLVariant struct {
+	Suffix  string            `yaml:"suffix,omitempty"`
+	Query   string            `yaml:"query,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// TargetAuthConfig is a configuration of credentials sent to a purge target
+type TargetAuthConfig struct {
+	Type     string `yaml:"type,omitempty"`
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	Token    string `yaml:"token,omitempty"`
+}
+
+// TargetConfig is a configuration of a purge target
+type TargetConfig struct {
+	Name         string `yaml:"name"`
+	URLPrefix    string `yaml:"url_prefix"`
+	HostOverride string `yaml:"host_override,omitempty"`
+	Method       string `yaml:"method,omitempty"`
+	// SubtreeMethod is a HTTP method to purge everything under a path, e.g., BAN for Varnish
+	SubtreeMethod  string           `yaml:"subtree_method,omitempty"`
+	Backend        string           `yaml:"backend,omitempty"`
+	Auth           TargetAuthConfig `yaml:"auth,omitempty"`
+	Timeout        time.Duration    `yaml:"timeout,omitempty"`
+	ConnectTimeout time.Duration    `yaml:"connect_timeout,omitempty"`
+	// MaxAge is the maximum age of cached objects, purges for events older than this are dropped, 0 for no limit
+	MaxAge time.Duration `yaml:"max_age,omitempty"`
+	// Anonymous marks a target serving anonymous users, see Config.ACLCheck
+	Anonymous bool `yaml:"anonymous,omitempty"`
+	// PathIncludes and PathExcludes filter paths to purge, see CompilePathPattern for the syntax
+	PathIncludes []string         `yaml:"path_includes,omitempty"`
+	PathExcludes []string         `yaml:"path_excludes,omitempty"`
+	Rewrites     []URLRewriteRule `yaml:"rewrites,omitempty"`
+	Variants     []URLVariant     `yaml:"variants,omitempty"`
+	// URLTemplates are URLs of derived resources purged in addition, e.g., /thumbnails{path}?size=256
+	// templates starting with "/" are relative to the scheme and host of URLPrefix
+	// placeholders are {path}, {parent}, {basename}, {extension}, {uuid} and {zone}
+	URLTemplates []string `yaml:"url_templates,omitempty"`
+}
+
+// TargetConfigs is a list of purge targets, it can be given via an environmental variable in YAML or JSON
+type TargetConfigs []TargetConfig
+
+// Decode decodes TargetConfigs from an environmental variable
+func (targets *TargetConfigs) Decode(value string) error {
+	newTargets := TargetConfigs{}
+	err := yaml.Unmarshal([]byte(value), &newTargets)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal targets - %v", err)
+	}
+
+	*targets = newTargets
+	return nil
+}
+
+// Validate validates the rewrite rule
+func (rule *URLRewriteRule) Validate() error {
+	if len(rule.Prefix) > 0 && len(rule.Regex) > 0 {
+		return fmt.Errorf("either prefix or regex must be given for a rewrite rule, not both")
+	}
+
+	if len(rule.Prefix) == 0 && len(rule.Regex) == 0 {
+		return fmt.Errorf("prefix or regex must be given for a rewrite rule")
+	}
+
+	if len(rule.Regex) > 0 {
+		_, err := regexp.Compile(rule.Regex)
+		if err != nil {
+			return fmt.Errorf("failed to compile a rewrite regex '%s' - %v", rule.Regex, err)
+		}
+	}
+
+	return nil
+}
+
+// GetMethod returns HTTP method to purge
+func (target *TargetConfig) GetMethod() string {
+	if len(target.Method) > 0 {
+		return strings.ToUpper(target.Method)
+	}
+	return TargetMethodDefault
+}
+
+// GetSubtreeMethod returns HTTP method to purge a subtree
+// ngx_cache_purge purges a subtree with the purge method and a URL ending with "*"
+func (target *TargetConfig) GetSubtreeMethod() string {
+	if len(target.SubtreeMethod) > 0 {
+		return strings.ToUpper(target.SubtreeMethod)
+	}
+
+	if target.GetBackend() == TargetBackendNginx {
+		return target.GetMethod()
+	}
+	return TargetSubtreeMethodDefault
+}
+
+// GetBackend returns backend type
+func (target *TargetConfig) GetBackend() string {
+	if len(target.Backend) > 0 {
+		return target.Backend
+	}
+	return TargetBackendVarnish
+}
+
+// GetAuthType returns auth type
+func (target *TargetConfig) GetAuthType() string {
+	if len(target.Auth.Type) > 0 {
+		return target.Auth.Type
+	}
+	return TargetAuthIRODS
+}
+
+// GetTimeout returns request timeout
+func (target *TargetConfig) GetTimeout() time.Duration {
+	if target.Timeout > 0 {
+		return target.Timeout
+	}
+	return TargetTimeoutDefault
+}
+
+// GetConnectTimeout returns connect timeout
+func (target *TargetConfig) GetConnectTimeout() time.Duration {
+	if target.ConnectTimeout > 0 {
+		return target.ConnectTimeout
+	}
+	return TargetConnectTimeoutDefault
+}
+
+// Validate validates the target
+func (target *TargetConfig) Validate() error {
+	if len(target.Name) == 0 {
+		return fmt.Errorf("target name must be given")
+	}
+
+	if len(target.URLPrefix) == 0 {
+		return fmt.Errorf("URL prefix must be given for target %s", target.Name)
+	}
+
+	u, err := url.Parse(target.URLPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to parse URL prefix '%s' of target %s - %v", target.URLPrefix, target.Name, err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("URL prefix '%s' of target %s must be http or https", target.URLPrefix, target.Name)
+	}
+
+	if len(u.Host) == 0 {
+		return fmt.Errorf("URL prefix '%s' of target %s must have a host", target.URLPrefix, target.Name)
+	}
+
+	if len(u.RawQuery) > 0 || len(u.Fragment) > 0 {
+		return fmt.Errorf("URL prefix '%s' of target %s must not have a query or a fragment", target.URLPrefix, target.Name)
+	}
+
+	switch target.GetBackend() {
+	case TargetBackendVarnish, TargetBackendNginx, TargetBackendHTTP:
+	default:
+		return fmt.Errorf("unknown backend %s of target %s", target.Backend, target.Name)
+	}
+
+	switch target.GetAuthType() {
+	case TargetAuthIRODS, TargetAuthNone:
+	case TargetAuthBasic:
+		if len(target.Auth.Username) == 0 {
+			return fmt.Errorf("auth username must be given for target %s", target.Name)
+		}
+	case TargetAuthBearer:
+		if len(target.Auth.Token) == 0 {
+			return fmt.Errorf("auth token must be given for target %s", target.Name)
+		}
+	default:
+		return fmt.Errorf("unknown auth type %s of target %s", target.Auth.Type, target.Name)
+	}
+
+	if target.Timeout < 0 || target.ConnectTimeout < 0 {
+		return fmt.Errorf("timeouts of target %s must not be negative", target.Name)
+	}
+
+	if target.MaxAge < 0 {
+		return fmt.Errorf("max age of target %s must not be negative", target.Name)
+	}
+
+	err = ValidatePathPatterns(target.PathIncludes)
+	if err != nil {
+		return fmt.Errorf("invalid path includes of target %s - %v", target.Name, err)
+	}
+
+	err = ValidatePathPatterns(target.PathExcludes)
+	if err != nil {
+		return fmt.Errorf("invalid path excludes of target %s - %v", target.Name, err)
+	}
+
+	for _, rule := range target.Rewrites {
+		err := rule.Validate()
+		if err != nil {
+			return fmt.Errorf("invalid rewrite rule of target %s - %v", target.Name, err)
+		}
+	}
+
+	for _, template := range target.URLTemplates {
+		if !strings.HasPrefix(template, "/") && !strings.HasPrefix(template, "http://") && !strings.HasPrefix(template, "https://") {
+			return fmt.Errorf("URL template '%s' of target %s must start with /, http:// or https://", template, target.Name)
+		}
+	}
+
+	return nil
+}
+
+// MigrateLegacyTargets converts deprecated Varnish URL settings to targets
+// returns deprecation warnings
+func (config *Config) MigrateLegacyTargets() ([]string, error) {
+	warnings := []string{}
+
+	if len(config.VarnishHostsOverride) > 0 && len(config.VarnishHostsOverride) != len(config.VarnishURLPrefixes) {
+		return nil, fmt.Errorf("the number of Varnish hosts override (%d) does not match the number of Varnish URLs (%d)", len(config.VarnishHostsOverride), len(config.VarnishURLPrefixes))
+	}
+
+	if len(config.VarnishURLPrefixes) > 0 {
+		warnings = append(warnings, "varnish_urls and varnish_hosts_override (PURGEMAN_VARNISH_URLS, PURGEMAN_VARNISH_HOSTS_OVERRIDE) are deprecated, use targets (PURGEMAN_TARGETS) instead")
+
+		for idx, urlPrefix := range config.VarnishURLPrefixes {
+			hostOverride := ""
+			if idx < len(config.VarnishHostsOverride) {
+				hostOverride = config.VarnishHostsOverride[idx]
+			}
+
+			config.Targets = append(config.Targets, TargetConfig{
+				Name:         fmt.Sprintf("varnish%d", idx),
+				URLPrefix:    urlPrefix,
+				HostOverride: hostOverride,
+			})
+		}
+	}
+
+	config.VarnishURLPrefixes = nil
+	config.VarnishHostsOverride = nil
+
+	if len(config.Targets) == 0 {
+		config.Targets = append(config.Targets, TargetConfig{
+			Name:      "default",
+			URLPrefix: VarnishURLPrefixDefault,
+		})
+	}
+
+	return warnings, nil
+}
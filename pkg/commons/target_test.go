@@ -0,0 +1,91 @@
+package commons
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMigrateLegacyTargets(t *testing.T) {
+	tests := []struct {
+		name          string
+		urlPrefixes   []string
+		hostsOverride []string
+		targets       TargetConfigs
+		expected      TargetConfigs
+		warnings      int
+		err           bool
+	}{
+		{
+			"no targets",
+			nil,
+			nil,
+			nil,
+			TargetConfigs{{Name: "default", URLPrefix: VarnishURLPrefixDefault}},
+			0,
+			false,
+		},
+		{
+			"targets",
+			nil,
+			nil,
+			TargetConfigs{{Name: "dav", URLPrefix: "http://127.0.0.1:6081/dav"}},
+			TargetConfigs{{Name: "dav", URLPrefix: "http://127.0.0.1:6081/dav"}},
+			0,
+			false,
+		},
+		{
+			"Varnish URLs with hosts override",
+			[]string{"http://127.0.0.1:6081/dav", "http://127.0.0.1:6082/dav"},
+			[]string{"data.cyverse.org", "anon.cyverse.org"},
+			nil,
+			TargetConfigs{
+				{Name: "varnish0", URLPrefix: "http://127.0.0.1:6081/dav", HostOverride: "data.cyverse.org"},
+				{Name: "varnish1", URLPrefix: "http://127.0.0.1:6082/dav", HostOverride: "anon.cyverse.org"},
+			},
+			1,
+			false,
+		},
+		{
+			"hosts override not matching Varnish URLs",
+			[]string{"http://127.0.0.1:6081/dav", "http://127.0.0.1:6082/dav"},
+			[]string{"data.cyverse.org"},
+			nil,
+			nil,
+			0,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := NewDefaultConfig()
+			config.VarnishURLPrefixes = test.urlPrefixes
+			config.VarnishHostsOverride = test.hostsOverride
+			config.Targets = test.targets
+
+			warnings, err := config.MigrateLegacyTargets()
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to migrate - %v", err)
+			}
+
+			if len(warnings) != test.warnings {
+				t.Errorf("expected %d warnings, got %v", test.warnings, warnings)
+			}
+
+			if !reflect.DeepEqual(config.Targets, test.expected) {
+				t.Errorf("expected targets %v, got %v", test.expected, config.Targets)
+			}
+
+			if len(config.VarnishURLPrefixes) > 0 || len(config.VarnishHostsOverride) > 0 {
+				t.Error("expected Varnish URL settings to be cleared")
+			}
+		})
+	}
+}
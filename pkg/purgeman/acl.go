@@ -0,0 +1,86 @@
+package purgeman
+
+import (
+	irodsfs_clientfs "github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/go-irodsclient/irods/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// isAnonymousReadable checks if anonymous users can read the path now, or could read it before
+// the cached state is used while fresh, ACLs are listed on a miss or when the event may have changed them
+// returns true when it cannot be determined, so anonymous caches are never left stale
+func (svc *PurgemanService) isAnonymousReadable(path string, eventType string) bool {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgemanService",
+		"function": "isAnonymousReadable",
+	})
+
+	// readability before the change, if it was looked up recently
+	wasReadable, known := svc.ACLCache.Get(path)
+	if known && !aclMayHaveChanged(eventType) {
+		return wasReadable
+	}
+
+	var accesses []*types.IRODSAccess
+	err := svc.withIRODSClient(func(fsClient *irodsfs_clientfs.FileSystem) error {
+		conn, err := fsClient.Session.AcquireConnection()
+		if err != nil {
+			return err
+		}
+		defer fsClient.Session.ReturnConnection(conn)
+
+		accesses, err = queryIRODSAccesses(conn, path)
+		return err
+	})
+
+	if err != nil {
+		logger.WithError(err).Errorf("Failed to list ACLs of %s", path)
+		return !known || wasReadable
+	}
+
+	if len(accesses) == 0 {
+		// removed or moved away, only the cached state tells if it was readable
+		return !known || wasReadable
+	}
+
+	readable := svc.hasAnonymousRead(accesses)
+	svc.ACLCache.Put(path, readable)
+
+	return readable || wasReadable
+}
+
+// aclMayHaveChanged checks if ACLs of the path of the event may be different from the cached ones
+// removed or moved paths may have lost or inherited access, and events of unknown types are not trusted
+func aclMayHaveChanged(eventType string) bool {
+	switch eventType {
+	case "data-object.rm", "data-object.mv", "collection.rm", "collection.mv", "":
+		return true
+	}
+	return false
+}
+
+// hasAnonymousRead checks if any of anonymous users has read access
+func (svc *PurgemanService) hasAnonymousRead(accesses []*types.IRODSAccess) bool {
+	for _, access := range accesses {
+		if !containsString(svc.Config.AnonymousUsers, access.UserName) {
+			continue
+		}
+
+		switch access.AccessLevel {
+		case types.IRODSAccessLevelRead, types.IRODSAccessLevelWrite, types.IRODSAccessLevelOwner, "read_object", "modify_object":
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package purgeman
+
+import (
+	"time"
+)
+
+// AnonymousAccessCache is a LRU cache that keeps if anonymous users can read iRODS paths
+type AnonymousAccessCache struct {
+	*LRUCache
+}
+
+// NewAnonymousAccessCache creates a new AnonymousAccessCache
+func NewAnonymousAccessCache(maxSize int, ttl time.Duration) *AnonymousAccessCache {
+	return &AnonymousAccessCache{
+		LRUCache: NewLRUCache(maxSize, ttl),
+	}
+}
+
+// Get returns if anonymous users could read the path
+func (cache *AnonymousAccessCache) Get(path string) (bool, bool) {
+	value, ok := cache.LRUCache.Get(path)
+	if !ok {
+		return false, false
+	}
+	return value.(bool), true
+}
+
+// Put adds or updates if anonymous users can read the path
+func (cache *AnonymousAccessCache) Put(path string, readable bool) {
+	cache.LRUCache.Put(path, readable)
+}
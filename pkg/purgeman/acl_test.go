@@ -0,0 +1,63 @@
+package purgeman
+
+import (
+	"testing"
+	"time"
+)
+
+func TestACLMayHaveChanged(t *testing.T) {
+	tests := []struct {
+		eventType string
+		changed   bool
+	}{
+		{"data-object.add", false},
+		{"data-object.mod", false},
+		{"data-object.sys-metadata.mod", false},
+		{"collection.add", false},
+		{"data-object.rm", true},
+		{"data-object.mv", true},
+		{"collection.rm", true},
+		{"collection.mv", true},
+		{"", true},
+	}
+
+	for _, test := range tests {
+		if aclMayHaveChanged(test.eventType) != test.changed {
+			t.Errorf("expected %t for event type %q", test.changed, test.eventType)
+		}
+	}
+}
+
+func TestAnonymousAccessCache(t *testing.T) {
+	cache := NewAnonymousAccessCache(2, time.Hour)
+
+	cache.Put("/a", true)
+	cache.Put("/b", false)
+
+	// makes /b the least recently used
+	if readable, ok := cache.Get("/a"); !ok || !readable {
+		t.Errorf("expected /a to be readable, got %t (%t)", readable, ok)
+	}
+
+	cache.Put("/c", true)
+
+	if _, ok := cache.Get("/b"); ok {
+		t.Errorf("expected /b to be evicted")
+	}
+
+	if readable, ok := cache.Get("/c"); !ok || !readable {
+		t.Errorf("expected /c to be readable, got %t (%t)", readable, ok)
+	}
+
+	expiring := NewAnonymousAccessCache(2, time.Millisecond)
+	expiring.Put("/a", true)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := expiring.Get("/a"); ok {
+		t.Errorf("expected /a to expire")
+	}
+
+	if expiring.Len() != 0 {
+		t.Errorf("expected an expired entry to be removed, got %d entries", expiring.Len())
+	}
+}
@@ -0,0 +1,216 @@
+package purgeman
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// AdminPurgeRequest is a request body of the admin purge API
+type AdminPurgeRequest struct {
+	Paths   []string `json:"paths"`
+	Subtree bool     `json:"subtree,omitempty"`
+	// Event applies policy rules of the event type, e.g., data-object.mod, instead of purging the paths only
+	Event string `json:"event,omitempty"`
+}
+
+// AdminPurgeResponse is a response body of the admin purge API
+type AdminPurgeResponse struct {
+	Results []*PurgeResult `json:"results"`
+	Failed  int            `json:"failed"`
+}
+
+// AdminTarget is a purge target in the admin target list
+type AdminTarget struct {
+	Name         string          `json:"name"`
+	URLPrefix    string          `json:"url_prefix"`
+	HostOverride string          `json:"host_override,omitempty"`
+	Backend      string          `json:"backend"`
+	Method       string          `json:"method"`
+	Anonymous    bool            `json:"anonymous,omitempty"`
+	Health       ComponentHealth `json:"health"`
+}
+
+// registerAdminAPI registers handlers of the admin API
+func (svc *PurgemanService) registerAdminAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/admin/purge", svc.adminHandler(http.MethodPost, svc.handleAdminPurge))
+	mux.HandleFunc("/admin/targets", svc.adminHandler(http.MethodGet, svc.handleAdminTargets))
+	mux.HandleFunc("/admin/amqp/pause", svc.adminHandler(http.MethodPost, svc.handleAdminPauseAMQP))
+	mux.HandleFunc("/admin/amqp/resume", svc.adminHandler(http.MethodPost, svc.handleAdminResumeAMQP))
+	mux.HandleFunc("/admin/retry/flush", svc.adminHandler(http.MethodPost, svc.handleAdminFlushRetryQueue))
+	mux.HandleFunc("/admin/config", svc.adminHandler(http.MethodGet, svc.handleAdminConfig))
+	mux.HandleFunc("/admin/canary", svc.adminHandler(http.MethodGet, svc.handleAdminCanary))
+}
+
+// adminHandler wraps the handler to check the method and the admin token
+func (svc *PurgemanService) adminHandler(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := log.WithFields(log.Fields{
+			"package":  "purgeman",
+			"struct":   "PurgemanService",
+			"function": "adminHandler",
+		})
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(svc.Config.AdminToken)) != 1 {
+			logger.Warnf("Rejected an admin request to %s from %s", r.URL.Path, r.RemoteAddr)
+			writeJSONError(w, http.StatusUnauthorized, fmt.Errorf("invalid admin token"))
+			return
+		}
+
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+			return
+		}
+
+		logger.Infof("Handling an admin request to %s from %s", r.URL.Path, r.RemoteAddr)
+		handler(w, r)
+	}
+}
+
+// handleAdminPurge purges paths through targets
+func (svc *PurgemanService) handleAdminPurge(w http.ResponseWriter, r *http.Request) {
+	request := AdminPurgeRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("failed to parse a request - %v", err))
+		return
+	}
+
+	if len(request.Paths) == 0 {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("paths must be given"))
+		return
+	}
+
+	if len(request.Event) > 0 {
+		if !IsFSEventType(request.Event) {
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("unknown event type %s", request.Event))
+			return
+		}
+
+		if request.Subtree {
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("subtree cannot be used with event, policy rules decide what to purge"))
+			return
+		}
+	}
+
+	for _, path := range request.Paths {
+		if !strings.HasPrefix(path, "/") {
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("path %s must be an absolute iRODS path", path))
+			return
+		}
+	}
+
+	response := AdminPurgeResponse{
+		Results: svc.PurgePaths(request.Paths, request.Subtree, request.Event),
+	}
+
+	for _, result := range response.Results {
+		if len(result.Error) > 0 {
+			response.Failed++
+		}
+	}
+
+	writeJSON(w, http.StatusOK, &response)
+}
+
+// handleAdminTargets lists targets with their health
+func (svc *PurgemanService) handleAdminTargets(w http.ResponseWriter, r *http.Request) {
+	health := svc.Health.Snapshot()
+
+	targets := []AdminTarget{}
+	for _, target := range svc.Targets {
+		targets = append(targets, AdminTarget{
+			Name:         target.Config.Name,
+			URLPrefix:    target.Config.URLPrefix,
+			HostOverride: target.Config.HostOverride,
+			Backend:      target.Config.GetBackend(),
+			Method:       target.Config.GetMethod(),
+			Anonymous:    target.Config.Anonymous,
+			Health:       health[target.healthComponent()],
+		})
+	}
+
+	writeJSON(w, http.StatusOK, targets)
+}
+
+// handleAdminPauseAMQP pauses consumption of AMQP messages
+func (svc *PurgemanService) handleAdminPauseAMQP(w http.ResponseWriter, r *http.Request) {
+	svc.PauseAMQP()
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": true})
+}
+
+// handleAdminResumeAMQP resumes consumption of AMQP messages
+func (svc *PurgemanService) handleAdminResumeAMQP(w http.ResponseWriter, r *http.Request) {
+	svc.ResumeAMQP()
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": false})
+}
+
+// handleAdminFlushRetryQueue drops all events in the retry queue
+func (svc *PurgemanService) handleAdminFlushRetryQueue(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgemanService",
+		"function": "handleAdminFlushRetryQueue",
+	})
+
+	flushed := svc.RetryQueue.Flush()
+	logger.Infof("Flushed %d events in the retry queue", flushed)
+
+	writeJSON(w, http.StatusOK, map[string]int{"flushed": flushed})
+}
+
+// handleAdminConfig shows the runtime configuration with secrets redacted, in YAML as in config files
+func (svc *PurgemanService) handleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	yamlBytes, err := yaml.Marshal(svc.Config.Redacted())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("failed to marshal the config - %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(yamlBytes)
+}
+
+// handleAdminCanary shows how a recent canary given by id is handled
+func (svc *PurgemanService) handleAdminCanary(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if len(id) == 0 {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("canary id must be given"))
+		return
+	}
+
+	record, ok := svc.Canaries.Get(id)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("canary %s is not handled", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, record)
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"function": "writeJSON",
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		logger.WithError(err).Error("Failed to write a response")
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, statusCode int, err error) {
+	writeJSON(w, statusCode, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,49 @@
+package purgeman
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+)
+
+func TestHandleAdminPurgeValidatesRequests(t *testing.T) {
+	svc, received := newTestService(t, func(config *commons.Config) {
+		config.AdminToken = "token"
+	})
+
+	tests := []struct {
+		name       string
+		body       string
+		statusCode int
+	}{
+		{"invalid json", `{`, http.StatusBadRequest},
+		{"no paths", `{"paths": []}`, http.StatusBadRequest},
+		{"relative path", `{"paths": ["iplant/home"]}`, http.StatusBadRequest},
+		{"unknown event", `{"paths": ["/iplant/home/a.txt"], "event": "data-object.unknown"}`, http.StatusBadRequest},
+		{"event with subtree", `{"paths": ["/iplant/home"], "event": "collection.rm", "subtree": true}`, http.StatusBadRequest},
+		{"valid event", `{"paths": ["/iplant/home/a.txt"], "event": "data-object.mod"}`, http.StatusOK},
+	}
+
+	handler := svc.adminHandler(http.MethodPost, svc.handleAdminPurge)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/admin/purge", strings.NewReader(test.body))
+			request.Header.Set("Authorization", "Bearer token")
+
+			recorder := httptest.NewRecorder()
+			handler(recorder, request)
+
+			if recorder.Code != test.statusCode {
+				t.Errorf("expected status %d, got %d - %s", test.statusCode, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+
+	// only the valid request is purged, the file and its parent
+	if paths := received(); len(paths) != 2 {
+		t.Errorf("expected purges of the valid request only, got %v", paths)
+	}
+}
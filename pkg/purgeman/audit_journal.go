@@ -0,0 +1,249 @@
+package purgeman
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// AuditEntry is a record of an event handled and purges made for a path
+type AuditEntry struct {
+	Time    time.Time      `json:"time"`
+	Event   *FSEvent       `json:"event,omitempty"`  // nil for manual purges without an event type
+	Manual  bool           `json:"manual,omitempty"` // true if purges are requested via the admin API or the command line
+	Path    string         `json:"path"`             // resolved iRODS path, empty if the event is skipped before resolving it
+	Skipped string         `json:"skipped,omitempty"`
+	Results []*PurgeResult `json:"results,omitempty"`
+}
+
+// AuditJournal appends audit entries to a file in JSON lines format, the file is rotated by size
+type AuditJournal struct {
+	Path   string
+	writer *lumberjack.Logger
+	mutex  sync.Mutex
+}
+
+// NewAuditJournal creates a new AuditJournal
+// maxSize is in megabytes, old journals more than maxBackups are removed
+func NewAuditJournal(path string, maxSize int, maxBackups int) *AuditJournal {
+	return &AuditJournal{
+		Path: path,
+		writer: &lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    maxSize,
+			MaxBackups: maxBackups,
+			Compress:   false,
+		},
+	}
+}
+
+// Write appends an audit entry
+func (journal *AuditJournal) Write(entry *AuditEntry) error {
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	_, err = journal.writer.Write(append(entryBytes, '\n'))
+	return err
+}
+
+// Close closes the journal file
+func (journal *AuditJournal) Close() error {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	return journal.writer.Close()
+}
+
+// ReadAuditJournal reads audit entries and calls the handler for each entry
+// lines that are not valid entries, e.g., partially written ones, are skipped
+func ReadAuditJournal(reader io.Reader, handler func(entry *AuditEntry) error) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"function": "ReadAuditJournal",
+	})
+
+	bufReader := bufio.NewReader(reader)
+	lineNum := 0
+	for {
+		line, err := bufReader.ReadBytes('\n')
+		if len(line) > 0 {
+			lineNum++
+
+			entry := &AuditEntry{}
+			jsonErr := json.Unmarshal(line, entry)
+			if jsonErr != nil {
+				logger.WithError(jsonErr).Warnf("Skipping an invalid audit entry at line %d", lineNum)
+			} else {
+				handlerErr := handler(entry)
+				if handlerErr != nil {
+					return handlerErr
+				}
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read audit entries - %v", err)
+		}
+	}
+}
+
+// AuditFilter selects audit entries to replay
+type AuditFilter struct {
+	Since      time.Time // inclusive, ignored if zero
+	Until      time.Time // exclusive, ignored if zero
+	PathPrefix string    // a collection path, ignored if empty
+}
+
+// Matches checks if the audit entry is selected
+func (filter *AuditFilter) Matches(entry *AuditEntry) bool {
+	if !filter.Since.IsZero() && entry.Time.Before(filter.Since) {
+		return false
+	}
+
+	if !filter.Until.IsZero() && !entry.Time.Before(filter.Until) {
+		return false
+	}
+
+	if len(filter.PathPrefix) > 0 && !isPathUnder(entry.Path, filter.PathPrefix) {
+		return false
+	}
+
+	return true
+}
+
+// AuditReplay collects purge requests recorded in audit entries to re-issue them
+// identical requests to a target are collected once
+type AuditReplay struct {
+	Filter   AuditFilter
+	Requests []*ReplayRequest
+
+	keys map[string]bool
+}
+
+// ReplayRequest is a purge request to be re-issued to a target
+type ReplayRequest struct {
+	Target  string
+	Path    string
+	Request *PurgeRequest
+}
+
+// NewAuditReplay creates a new AuditReplay
+func NewAuditReplay(filter AuditFilter) *AuditReplay {
+	return &AuditReplay{
+		Filter:   filter,
+		Requests: []*ReplayRequest{},
+		keys:     map[string]bool{},
+	}
+}
+
+// Add collects purge requests of the audit entry if the filter selects it
+func (replay *AuditReplay) Add(entry *AuditEntry) error {
+	if !replay.Filter.Matches(entry) {
+		return nil
+	}
+
+	for _, result := range entry.Results {
+		for _, requestResult := range result.Requests {
+			request := requestResult.Request()
+
+			headerBytes, err := json.Marshal(request.Headers)
+			if err != nil {
+				return err
+			}
+
+			key := strings.Join([]string{result.Target, request.Method, request.URL, request.Host, string(headerBytes)}, "\n")
+			if replay.keys[key] {
+				continue
+			}
+			replay.keys[key] = true
+
+			replay.Requests = append(replay.Requests, &ReplayRequest{
+				Target:  result.Target,
+				Path:    result.Path,
+				Request: request,
+			})
+		}
+	}
+	return nil
+}
+
+// ReplayResult is an outcome of a re-issued purge request
+type ReplayResult struct {
+	Target string
+	Path   string
+	Result *PurgeRequestResult
+}
+
+// ReplayPurges re-issues the purge requests through the targets of the same names
+// requests to a target are sent one by one, targets receive requests in parallel
+func (svc *PurgemanService) ReplayPurges(requests []*ReplayRequest) []*ReplayResult {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgemanService",
+		"function": "ReplayPurges",
+	})
+
+	targets := map[string]*PurgeTarget{}
+	for _, target := range svc.Targets {
+		targets[target.Config.Name] = target
+	}
+
+	results := make([]*ReplayResult, len(requests))
+	requestsByTarget := map[string][]int{}
+	for idx, request := range requests {
+		results[idx] = &ReplayResult{
+			Target: request.Target,
+			Path:   request.Path,
+			Result: &PurgeRequestResult{
+				Method:  request.Request.Method,
+				URL:     request.Request.URL,
+				Host:    request.Request.Host,
+				Headers: request.Request.Headers,
+			},
+		}
+
+		if _, ok := targets[request.Target]; !ok {
+			results[idx].Result.Error = fmt.Sprintf("target %s is not configured", request.Target)
+			continue
+		}
+
+		requestsByTarget[request.Target] = append(requestsByTarget[request.Target], idx)
+	}
+
+	wg := sync.WaitGroup{}
+	for name, indices := range requestsByTarget {
+		wg.Add(1)
+
+		go func(target *PurgeTarget, indices []int) {
+			defer wg.Done()
+
+			for _, idx := range indices {
+				status, err := target.Send(requests[idx].Request)
+				results[idx].Result.Status = status
+				if err != nil {
+					logger.Error(err)
+					results[idx].Result.Error = err.Error()
+				}
+			}
+		}(targets[name], indices)
+	}
+
+	wg.Wait()
+	return results
+}
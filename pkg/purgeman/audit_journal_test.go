@@ -0,0 +1,187 @@
+package purgeman
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+)
+
+func TestFSEventHandlerJournalsSkippedEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   *FSEvent
+		skipped string
+	}{
+		{
+			"event filter",
+			&FSEvent{
+				EventType: "data-object.mod",
+				Path:      "/iplant/home/user/a.txt",
+				Body: map[string]interface{}{
+					"author": map[string]interface{}{
+						"name": "bot",
+					},
+				},
+			},
+			"event filter",
+		},
+		{
+			"expired",
+			&FSEvent{
+				EventType: "data-object.mod",
+				Path:      "/iplant/home/user/a.txt",
+				Timestamp: time.Now().Add(-2 * time.Hour),
+			},
+			"older than max age of all targets",
+		},
+		{
+			"path filter",
+			&FSEvent{
+				EventType: "data-object.mod",
+				Path:      "/iplant/trash/a.txt",
+			},
+			"filtered out",
+		},
+		{
+			"dead letter",
+			&FSEvent{
+				EventType: "data-object.mod",
+				UUID:      "unknown",
+			},
+			"dead letter",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "purgeman-journal")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			journalPath := filepath.Join(dir, "journal.jsonl")
+			svc, received := newTestService(t, func(config *commons.Config) {
+				config.AuditJournalPath = journalPath
+				config.IgnoreUsers = []string{"bot"}
+				config.PathExcludes = []string{"/iplant/trash/**"}
+				config.Targets[0].MaxAge = time.Hour
+				// unresolved events are dead-lettered as they cannot be buffered
+				config.PendingBufferSize = 0
+			})
+
+			svc.fsEventHandler(test.event)
+
+			if paths := received(); len(paths) != 0 {
+				t.Errorf("expected no purges, got %v", paths)
+			}
+
+			journal, err := os.Open(journalPath)
+			if err != nil {
+				t.Fatalf("failed to open the journal - %v", err)
+			}
+			defer journal.Close()
+
+			entries := []*AuditEntry{}
+			err = ReadAuditJournal(journal, func(entry *AuditEntry) error {
+				entries = append(entries, entry)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(entries) != 1 || !strings.HasPrefix(entries[0].Skipped, test.skipped) {
+				t.Fatalf("expected an entry skipped for %q, got %+v", test.skipped, entries)
+			}
+
+			if entries[0].Event == nil || entries[0].Event.EventType != test.event.EventType {
+				t.Errorf("expected the event to be recorded, got %+v", entries[0].Event)
+			}
+		})
+	}
+}
+
+func TestReadAuditJournalSkipsInvalidLines(t *testing.T) {
+	journal := strings.Join([]string{
+		`{"time":"2021-01-01T00:00:00Z","path":"/iplant/a"}`,
+		`{"time":"2021-01-01T00:00:01Z","pa`,
+		`{"time":"2021-01-01T00:00:02Z","path":"/iplant/b"}`,
+	}, "\n")
+
+	paths := []string{}
+	err := ReadAuditJournal(strings.NewReader(journal), func(entry *AuditEntry) error {
+		paths = append(paths, entry.Path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(paths, ",") != "/iplant/a,/iplant/b" {
+		t.Errorf("unexpected entries %v", paths)
+	}
+}
+
+func TestAuditReplayDeduplicatesRequests(t *testing.T) {
+	baseTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newEntry := func(offset time.Duration, path string, target string, url string) *AuditEntry {
+		return &AuditEntry{
+			Time: baseTime.Add(offset),
+			Path: path,
+			Results: []*PurgeResult{
+				{
+					Target: target,
+					Path:   path,
+					Requests: []*PurgeRequestResult{
+						{Method: "PURGE", URL: url, Host: "example.org"},
+					},
+				},
+			},
+		}
+	}
+
+	entries := []*AuditEntry{
+		newEntry(0, "/iplant/home/a", "dav", "http://example.org/a"),
+		// the same request again
+		newEntry(time.Minute, "/iplant/home/a", "dav", "http://example.org/a"),
+		// the same request to another target
+		newEntry(2*time.Minute, "/iplant/home/a", "dav-anon", "http://example.org/a"),
+		newEntry(3*time.Minute, "/iplant/shared/b", "dav", "http://example.org/b"),
+		// skipped entries have no requests
+		{Time: baseTime, Path: "/iplant/home/c", Skipped: "filtered out"},
+	}
+
+	tests := []struct {
+		name     string
+		filter   AuditFilter
+		requests int
+	}{
+		{"all", AuditFilter{}, 3},
+		{"since", AuditFilter{Since: baseTime.Add(2 * time.Minute)}, 2},
+		{"until", AuditFilter{Until: baseTime.Add(2 * time.Minute)}, 1},
+		{"path prefix", AuditFilter{PathPrefix: "/iplant/shared"}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			replay := NewAuditReplay(test.filter)
+			for _, entry := range entries {
+				err := replay.Add(entry)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if len(replay.Requests) != test.requests {
+				t.Errorf("expected %d requests, got %d", test.requests, len(replay.Requests))
+			}
+		})
+	}
+}
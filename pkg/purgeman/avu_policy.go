@@ -0,0 +1,75 @@
+package purgeman
+
+import (
+	"path"
+	"strings"
+
+	irodsfs_clientfs "github.com/cyverse/go-irodsclient/fs"
+	irodsfs_clientirodsfs "github.com/cyverse/go-irodsclient/irods/fs"
+	log "github.com/sirupsen/logrus"
+)
+
+// getAVUPolicy returns the purge policy of the nearest collection having the policy AVU
+// policies are inherited down the tree, returns empty if no collections have the AVU
+func (svc *PurgemanService) getAVUPolicy(irodsPath string, isCollection bool) string {
+	collPath := irodsPath
+	if !isCollection {
+		collPath = path.Dir(irodsPath)
+	}
+
+	for len(collPath) > 0 && collPath != "/" {
+		policy := svc.getCollectionPolicy(collPath)
+		if len(policy) > 0 {
+			return policy
+		}
+
+		collPath = path.Dir(collPath)
+	}
+
+	return ""
+}
+
+// getCollectionPolicy returns the purge policy given in the AVU of the collection, returns empty if not given
+func (svc *PurgemanService) getCollectionPolicy(collPath string) string {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgemanService",
+		"function": "getCollectionPolicy",
+	})
+
+	if policy, ok := svc.PolicyCache.Get(collPath); ok {
+		return policy
+	}
+
+	policy := ""
+	err := svc.withIRODSClient(func(fsClient *irodsfs_clientfs.FileSystem) error {
+		conn, err := fsClient.Session.AcquireConnection()
+		if err != nil {
+			return err
+		}
+		defer fsClient.Session.ReturnConnection(conn)
+
+		// an empty list is returned for collections that do not exist, e.g., removed ones
+		metas, err := irodsfs_clientirodsfs.ListCollectionMeta(conn, collPath)
+		if err != nil {
+			return err
+		}
+
+		for _, meta := range metas {
+			if meta.Name == svc.Config.AVUPolicyAttribute {
+				policy = strings.TrimSpace(meta.Value)
+				break
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		// do not cache, the default policy is used this time
+		logger.WithError(err).Errorf("Failed to list metadata of %s", collPath)
+		return ""
+	}
+
+	svc.PolicyCache.Put(collPath, policy)
+	return policy
+}
@@ -0,0 +1,48 @@
+package purgeman
+
+import (
+	"testing"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+)
+
+func TestGetAVUPolicy(t *testing.T) {
+	config := commons.NewDefaultConfig()
+	config.AVUPolicy = true
+
+	svc, err := NewPurgeman(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Destroy()
+
+	// cached policies, so iRODS is not queried
+	svc.PolicyCache.Put("/iplant", "")
+	svc.PolicyCache.Put("/iplant/home", "")
+	svc.PolicyCache.Put("/iplant/home/user", "")
+	svc.PolicyCache.Put("/iplant/home/shared", "subtree")
+	svc.PolicyCache.Put("/iplant/home/shared/projects", "")
+	svc.PolicyCache.Put("/iplant/home/shared/projects/b", "skip")
+
+	tests := []struct {
+		name         string
+		path         string
+		isCollection bool
+		expected     string
+	}{
+		{"inherited from an ancestor", "/iplant/home/shared/projects/a.txt", false, "subtree"},
+		{"nearest collection wins", "/iplant/home/shared/projects/b/c.txt", false, "skip"},
+		{"collection itself", "/iplant/home/shared/projects/b", true, "skip"},
+		{"parent of a collection", "/iplant/home/shared/projects", true, "subtree"},
+		{"no policy", "/iplant/home/user/a.txt", false, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := svc.getAVUPolicy(test.path, test.isCollection)
+			if policy != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, policy)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package purgeman
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+	"github.com/rs/xid"
+	log "github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// CanaryField is a field of message body having the ID of a canary
+	CanaryField string = "purgeman_canary"
+	// CanaryEventType is an event type of canaries
+	CanaryEventType string = "data-object.add"
+	// CanaryPublishTimeout is a timeout to connect to AMQP to publish a canary
+	CanaryPublishTimeout = 10 * time.Second
+	// CanaryTrackerSize is the number of canaries handled that are kept for lookups
+	CanaryTrackerSize int = 100
+	// ComponentCanary is a component name of canaries in health reports
+	ComponentCanary string = "canary"
+)
+
+// CanaryRecord is a record of a canary event handled
+type CanaryRecord struct {
+	ID      string         `json:"id"`
+	Time    time.Time      `json:"time"` // time when the purges are made
+	Path    string         `json:"path"`
+	Skipped string         `json:"skipped,omitempty"`
+	Results []*PurgeResult `json:"results,omitempty"`
+}
+
+// Failed returns the number of purges failed
+func (record *CanaryRecord) Failed() int {
+	failed := 0
+	for _, result := range record.Results {
+		if len(result.Error) > 0 {
+			failed++
+		}
+	}
+	return failed
+}
+
+// PublishCanary publishes a synthetic data-object.add event for the canary path to the exchange
+// returns the ID of the canary and the time of publishing
+func PublishCanary(config *commons.Config) (string, time.Time, error) {
+	if len(config.CanaryPath) == 0 {
+		return "", time.Time{}, fmt.Errorf("canary path is not given")
+	}
+
+	if len(config.AMQPExchange) == 0 {
+		return "", time.Time{}, fmt.Errorf("AMQP exchange is not given")
+	}
+
+	mqConfig := &IRODSMessageQueueConfig{
+		Username: config.AMQPUsername,
+		Password: config.AMQPPassword,
+		Host:     config.AMQPHost,
+		Port:     config.AMQPPort,
+		VHost:    config.AMQPVHost,
+	}
+
+	amqpConn, err := amqp.DialConfig(makeAMQPURL(mqConfig), amqp.Config{
+		Dial: amqp.DefaultDial(CanaryPublishTimeout),
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to connect to AMQP - %v", err)
+	}
+	defer amqpConn.Close()
+
+	channel, err := amqpConn.Channel()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to open a channel - %v", err)
+	}
+	defer channel.Close()
+
+	id := xid.New().String()
+	now := time.Now()
+
+	body := map[string]interface{}{
+		"path":      config.CanaryPath,
+		CanaryField: id,
+	}
+
+	if len(config.EventTimestampField) > 0 {
+		body[config.EventTimestampField] = now.UTC().Format(time.RFC3339Nano)
+	}
+
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	err = channel.Publish(config.AMQPExchange, CanaryEventType, false, false, amqp.Publishing{
+		ContentType: "application/json",
+		Timestamp:   now,
+		Body:        bodyBytes,
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to publish a canary - %v", err)
+	}
+
+	return id, now, nil
+}
+
+// CanaryTracker keeps recent canaries handled
+type CanaryTracker struct {
+	MaxSize int
+
+	records map[string]*CanaryRecord
+	order   []string
+	waiters map[string][]chan *CanaryRecord
+	mutex   sync.Mutex
+}
+
+// NewCanaryTracker creates a new CanaryTracker
+func NewCanaryTracker(maxSize int) *CanaryTracker {
+	return &CanaryTracker{
+		MaxSize: maxSize,
+		records: map[string]*CanaryRecord{},
+		order:   []string{},
+		waiters: map[string][]chan *CanaryRecord{},
+	}
+}
+
+// Record keeps the canary handled, and wakes up its waiters
+// a canary is recorded once for each path purged for it
+func (tracker *CanaryTracker) Record(record *CanaryRecord) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	if _, ok := tracker.records[record.ID]; !ok {
+		tracker.order = append(tracker.order, record.ID)
+	}
+	tracker.records[record.ID] = record
+
+	for len(tracker.order) > tracker.MaxSize {
+		delete(tracker.records, tracker.order[0])
+		tracker.order = tracker.order[1:]
+	}
+
+	for _, waiter := range tracker.waiters[record.ID] {
+		waiter <- record
+	}
+	delete(tracker.waiters, record.ID)
+}
+
+// Get returns the canary handled
+func (tracker *CanaryTracker) Get(id string) (*CanaryRecord, bool) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	record, ok := tracker.records[id]
+	return record, ok
+}
+
+// Wait waits until the canary is handled, returns false on timeout or when the done channel is closed
+func (tracker *CanaryTracker) Wait(id string, timeout time.Duration, done <-chan bool) (*CanaryRecord, bool) {
+	tracker.mutex.Lock()
+	if record, ok := tracker.records[id]; ok {
+		tracker.mutex.Unlock()
+		return record, true
+	}
+
+	waiter := make(chan *CanaryRecord, 1)
+	tracker.waiters[id] = append(tracker.waiters[id], waiter)
+	tracker.mutex.Unlock()
+
+	select {
+	case record := <-waiter:
+		return record, true
+	case <-time.After(timeout):
+	case <-done:
+	}
+
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	waiters := []chan *CanaryRecord{}
+	for _, w := range tracker.waiters[id] {
+		if w != waiter {
+			waiters = append(waiters, w)
+		}
+	}
+
+	if len(waiters) > 0 {
+		tracker.waiters[id] = waiters
+	} else {
+		delete(tracker.waiters, id)
+	}
+	return nil, false
+}
+
+// recordCanary records the event if it is a canary
+func (svc *PurgemanService) recordCanary(entry *AuditEntry) {
+	if entry.Event == nil {
+		return
+	}
+
+	id := getBodyString(entry.Event.Body, CanaryField)
+	if len(id) == 0 {
+		return
+	}
+
+	svc.Canaries.Record(&CanaryRecord{
+		ID:      id,
+		Time:    entry.Time,
+		Path:    entry.Path,
+		Skipped: entry.Skipped,
+		Results: entry.Results,
+	})
+}
+
+// runCanary publishes a canary periodically and checks if it is purged, returns when the service is terminated
+func (svc *PurgemanService) runCanary() {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgemanService",
+		"function": "runCanary",
+	})
+
+	svc.Health.Set(ComponentCanary, true, "no canaries yet")
+
+	for svc.sleep(svc.Config.CanaryInterval) {
+		if svc.AMQPPause.IsPaused() {
+			logger.Debug("Skipping a canary while AMQP consumption is paused")
+			continue
+		}
+
+		id, publishTime, err := PublishCanary(svc.Config)
+		if err != nil {
+			logger.WithError(err).Error("Failed to publish a canary")
+			svc.Metrics.ObserveCanary(CanaryResultFailure, 0)
+			svc.Health.SetError(ComponentCanary, err)
+			continue
+		}
+
+		record, ok := svc.Canaries.Wait(id, svc.Config.CanaryTimeout, svc.TerminateChan)
+		if !ok {
+			if svc.isTerminated() {
+				return
+			}
+
+			err = fmt.Errorf("canary %s is not handled in %s", id, svc.Config.CanaryTimeout)
+			logger.Error(err)
+			svc.Metrics.ObserveCanary(CanaryResultFailure, 0)
+			svc.Health.SetError(ComponentCanary, err)
+			continue
+		}
+
+		latency := record.Time.Sub(publishTime)
+		if len(record.Skipped) > 0 {
+			logger.Warnf("Canary %s is skipped - %s", id, record.Skipped)
+			svc.Metrics.ObserveCanary(CanaryResultSkipped, latency)
+			svc.Health.SetError(ComponentCanary, fmt.Errorf("canary %s is skipped - %s", id, record.Skipped))
+			continue
+		}
+
+		if failed := record.Failed(); failed > 0 {
+			err = fmt.Errorf("%d purges for canary %s failed", failed, id)
+			logger.Error(err)
+			svc.Metrics.ObserveCanary(CanaryResultFailure, latency)
+			svc.Health.SetError(ComponentCanary, err)
+			continue
+		}
+
+		logger.Infof("Canary %s is purged in %s", id, latency)
+		svc.Metrics.ObserveCanary(CanaryResultPurged, latency)
+		svc.Health.Set(ComponentCanary, true, fmt.Sprintf("last canary purged in %s", latency))
+	}
+}
+
+// FindCanaryInJournal looks up the canary in audit entries, returns false if it is not found
+func FindCanaryInJournal(reader io.Reader, id string) (*CanaryRecord, bool, error) {
+	var found *CanaryRecord
+	err := ReadAuditJournal(reader, func(entry *AuditEntry) error {
+		if found != nil || entry.Event == nil || getBodyString(entry.Event.Body, CanaryField) != id {
+			return nil
+		}
+
+		found = &CanaryRecord{
+			ID:      id,
+			Time:    entry.Time,
+			Path:    entry.Path,
+			Skipped: entry.Skipped,
+			Results: entry.Results,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return found, found != nil, nil
+}
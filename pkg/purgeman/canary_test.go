@@ -0,0 +1,120 @@
+package purgeman
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCanaryTrackerWait(t *testing.T) {
+	tracker := NewCanaryTracker(2)
+	done := make(chan bool)
+
+	// handled after waiting
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		tracker.Record(&CanaryRecord{ID: "canary1", Path: "/iplant/home/user/canary"})
+	}()
+
+	record, ok := tracker.Wait("canary1", 5*time.Second, done)
+	if !ok || record.Path != "/iplant/home/user/canary" {
+		t.Fatalf("expected canary1 to be handled, got %+v (%t)", record, ok)
+	}
+
+	// handled before waiting
+	record, ok = tracker.Wait("canary1", time.Millisecond, done)
+	if !ok || record.ID != "canary1" {
+		t.Errorf("expected canary1 to be kept, got %+v (%t)", record, ok)
+	}
+
+	if _, ok := tracker.Wait("canary2", 10*time.Millisecond, done); ok {
+		t.Errorf("expected a timeout for canary2")
+	}
+
+	close(done)
+	if _, ok := tracker.Wait("canary3", 5*time.Second, done); ok {
+		t.Errorf("expected waiting for canary3 to stop when done is closed")
+	}
+}
+
+func TestCanaryTrackerKeepsRecentCanaries(t *testing.T) {
+	tracker := NewCanaryTracker(2)
+	tracker.Record(&CanaryRecord{ID: "canary1"})
+	tracker.Record(&CanaryRecord{ID: "canary2"})
+	// recorded again for another path
+	tracker.Record(&CanaryRecord{ID: "canary2"})
+	tracker.Record(&CanaryRecord{ID: "canary3"})
+
+	if _, ok := tracker.Get("canary1"); ok {
+		t.Errorf("expected canary1 to be evicted")
+	}
+
+	for _, id := range []string{"canary2", "canary3"} {
+		if _, ok := tracker.Get(id); !ok {
+			t.Errorf("expected %s to be kept", id)
+		}
+	}
+}
+
+func TestCanaryRecordFailed(t *testing.T) {
+	record := &CanaryRecord{
+		Results: []*PurgeResult{
+			{Target: "a"},
+			{Target: "b", Error: "connection refused"},
+			{Target: "c", Skipped: "path filter"},
+		},
+	}
+
+	if failed := record.Failed(); failed != 1 {
+		t.Errorf("expected 1 failed purge, got %d", failed)
+	}
+}
+
+func TestFindCanaryInJournal(t *testing.T) {
+	entries := []*AuditEntry{
+		{
+			Path: "/iplant/home/user/a.txt",
+			Event: &FSEvent{
+				EventType: "data-object.add",
+				Body:      map[string]interface{}{"path": "/iplant/home/user/a.txt"},
+			},
+		},
+		{
+			Path: "/iplant/home/user/canary",
+			Event: &FSEvent{
+				EventType: CanaryEventType,
+				Body:      map[string]interface{}{"path": "/iplant/home/user/canary", CanaryField: "canary1"},
+			},
+			Results: []*PurgeResult{
+				{Target: "varnish", Path: "/iplant/home/user/canary"},
+			},
+		},
+		{
+			Manual: true,
+			Path:   "/iplant/home/user/b.txt",
+		},
+	}
+
+	journal := &bytes.Buffer{}
+	encoder := json.NewEncoder(journal)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	record, ok, err := FindCanaryInJournal(bytes.NewReader(journal.Bytes()), "canary1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok || record.Path != "/iplant/home/user/canary" || len(record.Results) != 1 {
+		t.Errorf("expected canary1 to be found, got %+v (%t)", record, ok)
+	}
+
+	_, ok, err = FindCanaryInJournal(bytes.NewReader(journal.Bytes()), "canary2")
+	if err != nil || ok {
+		t.Errorf("expected canary2 not to be found, got %t (%v)", ok, err)
+	}
+}
@@ -0,0 +1,177 @@
+package purgeman
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+// CapturedDelivery is a raw AMQP delivery recorded for offline testing
+type CapturedDelivery struct {
+	Time        time.Time              `json:"time"` // time of receipt
+	Exchange    string                 `json:"exchange,omitempty"`
+	RoutingKey  string                 `json:"routing_key"`
+	Headers     map[string]interface{} `json:"headers,omitempty"`
+	ContentType string                 `json:"content_type,omitempty"`
+	Timestamp   time.Time              `json:"timestamp,omitempty"` // timestamp property of the delivery
+	Body        string                 `json:"body"`
+}
+
+// NewCapturedDelivery creates a CapturedDelivery from the delivery
+func NewCapturedDelivery(msg amqp.Delivery, receiveTime time.Time) *CapturedDelivery {
+	return &CapturedDelivery{
+		Time:        receiveTime,
+		Exchange:    msg.Exchange,
+		RoutingKey:  msg.RoutingKey,
+		Headers:     msg.Headers,
+		ContentType: msg.ContentType,
+		Timestamp:   msg.Timestamp,
+		Body:        string(msg.Body),
+	}
+}
+
+// Delivery returns an AMQP delivery having the captured properties
+func (captured *CapturedDelivery) Delivery() amqp.Delivery {
+	return amqp.Delivery{
+		Exchange:    captured.Exchange,
+		RoutingKey:  captured.RoutingKey,
+		Headers:     amqp.Table(captured.Headers),
+		ContentType: captured.ContentType,
+		Timestamp:   captured.Timestamp,
+		Body:        []byte(captured.Body),
+	}
+}
+
+// CaptureWriter appends raw deliveries to a file in JSON lines format
+type CaptureWriter struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+// NewCaptureWriter creates a new CaptureWriter
+func NewCaptureWriter(path string) *CaptureWriter {
+	return &CaptureWriter{
+		Path: path,
+	}
+}
+
+// Write appends the delivery
+func (writer *CaptureWriter) Write(msg amqp.Delivery) error {
+	capturedBytes, err := json.Marshal(NewCapturedDelivery(msg, time.Now()))
+	if err != nil {
+		return err
+	}
+
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	file, err := os.OpenFile(writer.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(capturedBytes, '\n'))
+	return err
+}
+
+// ReplayEventSource feeds captured deliveries to the event handler as if they are received from AMQP
+type ReplayEventSource struct {
+	Path           string
+	Speed          float64  // 1 replays at the original speed, 2 replays twice as fast, 0 replays without delays
+	TimestampField string   // a field of message body having the time of the event, can be empty
+	Metrics        *Metrics // can be nil
+	Sequential     bool     // handles events one by one, they are handled concurrently as live deliveries otherwise
+}
+
+// Run replays the captured deliveries in order
+// returns when all deliveries are replayed or the done channel is closed, and all events handled
+func (source *ReplayEventSource) Run(handler FSEventHandler, done <-chan bool) (int, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "ReplayEventSource",
+		"function": "Run",
+	})
+
+	file, err := os.Open(source.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	// handlers running concurrently
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+
+	reader := bufio.NewReader(file)
+	replayed := 0
+	lineNum := 0
+	var lastTime time.Time
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			lineNum++
+
+			captured := &CapturedDelivery{}
+			jsonErr := json.Unmarshal(line, captured)
+			if jsonErr != nil {
+				logger.WithError(jsonErr).Warnf("Skipping an invalid delivery at line %d", lineNum)
+			} else {
+				if source.Speed > 0 && !lastTime.IsZero() && captured.Time.After(lastTime) {
+					delay := time.Duration(float64(captured.Time.Sub(lastTime)) / source.Speed)
+					select {
+					case <-done:
+						return replayed, nil
+					case <-time.After(delay):
+					}
+				}
+				lastTime = captured.Time
+
+				// keep the lag of events as it was captured, otherwise old events expire
+				shift := time.Since(captured.Time)
+				shiftedHandler := func(event *FSEvent) {
+					if !event.Timestamp.IsZero() {
+						event.Timestamp = event.Timestamp.Add(shift)
+					}
+					handler(event)
+				}
+
+				msg := captured.Delivery()
+				source.Metrics.EventReceived(msg.RoutingKey)
+				if acceptFSEvents(msg, source.Metrics) {
+					if source.Sequential {
+						handleFSEvents(msg, source.TimestampField, source.Metrics, shiftedHandler)
+					} else {
+						wg.Add(1)
+						go func() {
+							defer wg.Done()
+							handleFSEvents(msg, source.TimestampField, source.Metrics, shiftedHandler)
+						}()
+					}
+				}
+				replayed++
+			}
+		}
+
+		if err == io.EOF {
+			return replayed, nil
+		}
+
+		if err != nil {
+			return replayed, fmt.Errorf("failed to read captured deliveries - %v", err)
+		}
+
+		select {
+		case <-done:
+			return replayed, nil
+		default:
+		}
+	}
+}
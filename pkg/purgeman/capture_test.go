@@ -0,0 +1,126 @@
+package purgeman
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeTestCapture(t *testing.T, lines []string) string {
+	dir, err := ioutil.TempDir("", "purgeman-capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	capturePath := filepath.Join(dir, "capture.jsonl")
+	err = ioutil.WriteFile(capturePath, []byte(strings.Join(lines, "\n")+"\n"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return capturePath
+}
+
+func TestReplayEventSourceRun(t *testing.T) {
+	capturePath := writeTestCapture(t, []string{
+		`{"time":"2021-01-01T00:00:00Z","routing_key":"data-object.add","body":"{\"path\":\"/iplant/a\",\"entity\":\"uuid1\"}"}`,
+		`not json`,
+		`{"time":"2021-01-01T00:00:01Z","routing_key":"data-object.mv","body":"{\"old-path\":\"/iplant/b\",\"new-path\":\"/iplant/c\",\"entity\":\"uuid2\"}"}`,
+		// not a file system event
+		`{"time":"2021-01-01T00:00:02Z","routing_key":"data-object.acl-mod","body":"{}"}`,
+		`{"time":"2021-01-01T00:00:03Z","routing_key":"data-object.add","body":"not json"}`,
+	})
+
+	for _, sequential := range []bool{true, false} {
+		source := &ReplayEventSource{
+			Path:       capturePath,
+			Speed:      0,
+			Sequential: sequential,
+		}
+
+		paths := []string{}
+		mutex := sync.Mutex{}
+		replayed, err := source.Run(func(event *FSEvent) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			paths = append(paths, event.Path)
+		}, make(chan bool))
+		if err != nil {
+			t.Fatalf("failed to replay - %v", err)
+		}
+
+		// invalid lines are not counted, invalid bodies are
+		if replayed != 4 {
+			t.Errorf("expected 4 replayed deliveries, got %d", replayed)
+		}
+
+		// all events are handled when Run returns
+		sort.Strings(paths)
+		if strings.Join(paths, ",") != "/iplant/a,/iplant/c" {
+			t.Errorf("unexpected events %v (sequential %t)", paths, sequential)
+		}
+	}
+}
+
+func TestReplayEventSourceRunConcurrently(t *testing.T) {
+	capturePath := writeTestCapture(t, []string{
+		`{"time":"2021-01-01T00:00:00Z","routing_key":"data-object.add","body":"{\"path\":\"/iplant/a\"}"}`,
+		`{"time":"2021-01-01T00:00:00Z","routing_key":"data-object.add","body":"{\"path\":\"/iplant/b\"}"}`,
+	})
+
+	source := &ReplayEventSource{
+		Path: capturePath,
+	}
+
+	// each handler waits for the other, so they must run concurrently
+	started := sync.WaitGroup{}
+	started.Add(2)
+	finished := make(chan bool)
+	go func() {
+		source.Run(func(event *FSEvent) {
+			started.Done()
+			started.Wait()
+		}, make(chan bool))
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected events to be handled concurrently")
+	}
+}
+
+func TestReplayEventSourceRunStops(t *testing.T) {
+	capturePath := writeTestCapture(t, []string{
+		`{"time":"2021-01-01T00:00:00Z","routing_key":"data-object.add","body":"{\"path\":\"/iplant/a\"}"}`,
+		`{"time":"2021-01-01T01:00:00Z","routing_key":"data-object.add","body":"{\"path\":\"/iplant/b\"}"}`,
+	})
+
+	source := &ReplayEventSource{
+		Path:       capturePath,
+		Speed:      1,
+		Sequential: true,
+	}
+
+	done := make(chan bool)
+	replayed, err := source.Run(func(event *FSEvent) {
+		// stops while waiting an hour for the next delivery
+		close(done)
+	}, done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if replayed != 1 {
+		t.Errorf("expected 1 replayed delivery, got %d", replayed)
+	}
+}
@@ -0,0 +1,168 @@
+package purgeman
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+	"github.com/rs/xid"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// CheckAMQPTimeout is a timeout to connect to AMQP in checks
+	CheckAMQPTimeout = 10 * time.Second
+	// CheckPathName is a name of a path used to send harmless purge requests to targets in checks, nothing is cached for it
+	CheckPathName = ".purgeman-check"
+)
+
+const (
+	// CheckStatusPass means the check passed
+	CheckStatusPass = "PASS"
+	// CheckStatusWarn means the check passed, but something is likely to be a mistake
+	CheckStatusWarn = "WARN"
+	// CheckStatusFail means the check failed
+	CheckStatusFail = "FAIL"
+	// CheckStatusSkip means the check is not applicable
+	CheckStatusSkip = "SKIP"
+)
+
+// CheckResult is a result of a configuration or connectivity check
+type CheckResult struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+func newCheckResult(name string, err error, detail string) *CheckResult {
+	if err != nil {
+		return &CheckResult{
+			Name:   name,
+			Status: CheckStatusFail,
+			Detail: err.Error(),
+		}
+	}
+
+	return &CheckResult{
+		Name:   name,
+		Status: CheckStatusPass,
+		Detail: detail,
+	}
+}
+
+// CheckAMQP checks the AMQP connection, and the exchange and the queue with passive declares
+// nothing is declared or consumed
+func CheckAMQP(config *commons.Config) []*CheckResult {
+	if len(config.ReplayCapturePath) > 0 {
+		return []*CheckResult{
+			{
+				Name:   "amqp",
+				Status: CheckStatusSkip,
+				Detail: "deliveries are replayed from a capture file",
+			},
+		}
+	}
+
+	mqConfig := &IRODSMessageQueueConfig{
+		Username: config.AMQPUsername,
+		Password: config.AMQPPassword,
+		Host:     config.AMQPHost,
+		Port:     config.AMQPPort,
+		VHost:    config.AMQPVHost,
+	}
+
+	results := []*CheckResult{}
+
+	amqpConn, err := amqp.DialConfig(makeAMQPURL(mqConfig), amqp.Config{
+		Dial: amqp.DefaultDial(CheckAMQPTimeout),
+	})
+	results = append(results, newCheckResult("amqp connection", err, fmt.Sprintf("%s:%d vhost %s", config.AMQPHost, config.AMQPPort, config.AMQPVHost)))
+	if err != nil {
+		return results
+	}
+	defer amqpConn.Close()
+
+	// a failed passive declare closes the channel, so each check opens a channel
+	if len(config.AMQPExchange) > 0 {
+		name := fmt.Sprintf("amqp exchange %s", config.AMQPExchange)
+		channel, err := amqpConn.Channel()
+		if err == nil {
+			err = channel.ExchangeDeclarePassive(config.AMQPExchange, amqp.ExchangeTopic, false, false, false, false, nil)
+			channel.Close()
+		}
+		results = append(results, newCheckResult(name, err, "exists"))
+
+		// the queue is declared by the service, it may not exist while the service is not running
+		queueName := getDeclaredQueueName(config.DryRun)
+		channel, err = amqpConn.Channel()
+		var queue amqp.Queue
+		if err == nil {
+			queue, err = channel.QueueDeclarePassive(queueName, false, false, false, false, nil)
+			channel.Close()
+		}
+		results = append(results, newQueueCheckResult(fmt.Sprintf("amqp queue %s", queueName), queue, err))
+	}
+
+	return results
+}
+
+// newQueueCheckResult makes a result of a passive declare of the queue, a queue not declared yet is not a failure
+func newQueueCheckResult(name string, queue amqp.Queue, err error) *CheckResult {
+	if amqpErr, ok := err.(*amqp.Error); ok && amqpErr.Code == amqp.NotFound {
+		return &CheckResult{
+			Name:   name,
+			Status: CheckStatusWarn,
+			Detail: "not declared yet, purgeman declares it when it connects",
+		}
+	}
+
+	return newCheckResult(name, err, fmt.Sprintf("%d messages, %d consumers", queue.Messages, queue.Consumers))
+}
+
+// CheckIRODS checks the iRODS login
+func (svc *PurgemanService) CheckIRODS() *CheckResult {
+	name := "irods login"
+
+	err := svc.connectIRODS()
+	if err == nil {
+		err = svc.checkIRODS()
+	}
+
+	return newCheckResult(name, err, fmt.Sprintf("%s@%s:%d zone %s", svc.Config.IRODSUsername, svc.Config.IRODSHost, svc.Config.IRODSPort, svc.Config.IRODSZone))
+}
+
+// CheckTargets sends a harmless purge request to each target
+func (svc *PurgemanService) CheckTargets() []*CheckResult {
+	results := make([]*CheckResult, len(svc.Targets))
+	for idx, target := range svc.Targets {
+		name := fmt.Sprintf("target %s", target.Config.Name)
+
+		request, status, err := target.Probe(svc.Config.IRODSZone)
+		if request == nil {
+			results[idx] = newCheckResult(name, err, "")
+			continue
+		}
+
+		results[idx] = newCheckResult(name, err, fmt.Sprintf("%s %s responded %d", request.Method, request.URL, status))
+	}
+
+	return results
+}
+
+// Probe sends a purge request for a path that is never cached, so it checks reachability and permissions only
+// the target is marked unhealthy if it is not reachable, returns the request sent and the status code of the response
+func (target *PurgeTarget) Probe(zone string) (*PurgeRequest, int, error) {
+	probePath := fmt.Sprintf("/%s/%s/%s", zone, CheckPathName, xid.New().String())
+
+	requests, err := target.MakeRequests(PurgePath{
+		Path: probePath,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// the base request is enough, Send updates the health of the target as purges do
+	request := requests[0]
+	status, err := target.Send(request)
+	return request, status, err
+}
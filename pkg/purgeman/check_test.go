@@ -0,0 +1,113 @@
+package purgeman
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+	"github.com/streadway/amqp"
+)
+
+func TestNewQueueCheckResult(t *testing.T) {
+	tests := []struct {
+		name   string
+		queue  amqp.Queue
+		err    error
+		status string
+		detail string
+	}{
+		{"declared", amqp.Queue{Messages: 3, Consumers: 1}, nil, CheckStatusPass, "3 messages, 1 consumers"},
+		{"not declared yet", amqp.Queue{}, &amqp.Error{Code: amqp.NotFound, Reason: "NOT_FOUND"}, CheckStatusWarn, "not declared yet"},
+		{"access refused", amqp.Queue{}, &amqp.Error{Code: amqp.AccessRefused, Reason: "ACCESS_REFUSED"}, CheckStatusFail, "ACCESS_REFUSED"},
+		{"channel failure", amqp.Queue{}, fmt.Errorf("channel closed"), CheckStatusFail, "channel closed"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := newQueueCheckResult("amqp queue", test.queue, test.err)
+			if result.Status != test.status {
+				t.Errorf("expected %s, got %s (%s)", test.status, result.Status, result.Detail)
+			}
+
+			if !strings.Contains(result.Detail, test.detail) {
+				t.Errorf("expected detail to contain %q, got %q", test.detail, result.Detail)
+			}
+		})
+	}
+}
+
+func TestGetDeclaredQueueName(t *testing.T) {
+	name := getDeclaredQueueName(false)
+	if !strings.HasPrefix(name, "purgeman.") || strings.HasPrefix(name, "purgeman.dryrun.") {
+		t.Errorf("unexpected queue name %s", name)
+	}
+
+	dryRunName := getDeclaredQueueName(true)
+	if !strings.HasPrefix(dryRunName, "purgeman.dryrun.") {
+		t.Errorf("unexpected dry-run queue name %s", dryRunName)
+	}
+}
+
+func TestCheckTargets(t *testing.T) {
+	paths := []string{}
+	mutex := sync.Mutex{}
+	okServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		paths = append(paths, r.URL.Path)
+		mutex.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer okServer.Close()
+
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer failingServer.Close()
+
+	config := commons.NewDefaultConfig()
+	config.IRODSZone = "iplant"
+	config.Targets = commons.TargetConfigs{
+		{Name: "ok", URLPrefix: okServer.URL},
+		{Name: "forbidden", URLPrefix: failingServer.URL},
+	}
+
+	svc, err := NewPurgeman(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Destroy()
+
+	results := svc.CheckTargets()
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+
+	expected := []string{CheckStatusPass, CheckStatusFail}
+	for idx, result := range results {
+		if result.Status != expected[idx] {
+			t.Errorf("expected %s for %s, got %s (%s)", expected[idx], result.Name, result.Status, result.Detail)
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// a path that is never cached
+	if len(paths) != 1 || !strings.HasPrefix(paths[0], "/iplant/"+CheckPathName+"/") {
+		t.Errorf("expected a request for a check path, got %v", paths)
+	}
+}
+
+func TestCheckAMQPSkipsReplayedDeliveries(t *testing.T) {
+	config := commons.NewDefaultConfig()
+	config.ReplayCapturePath = "capture.jsonl"
+
+	results := CheckAMQP(config)
+	if len(results) != 1 || results[0].Status != CheckStatusSkip {
+		t.Errorf("expected the AMQP check to be skipped, got %+v", results)
+	}
+}
@@ -0,0 +1,323 @@
+package purgeman
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ControlCommandStatus shows the status of the daemon
+	ControlCommandStatus string = "status"
+	// ControlCommandStop stops the daemon
+	ControlCommandStop string = "stop"
+	// ControlCommandReload replaces the service of the daemon with one running the config given
+	ControlCommandReload string = "reload"
+
+	// ControlSocketMode is a file mode of the control socket, only the owner can connect to it
+	ControlSocketMode os.FileMode = 0600
+	// ControlTimeout is a timeout of a control request
+	ControlTimeout = 30 * time.Second
+	// RecentErrorsSize is the number of recent errors kept for the status
+	RecentErrorsSize int = 50
+)
+
+// ControlRequest is a request sent to the control socket
+type ControlRequest struct {
+	Command string `json:"command"`
+	Config  string `json:"config,omitempty"` // YAML config to reload
+}
+
+// ControlResponse is a response from the control socket
+type ControlResponse struct {
+	Error    string        `json:"error,omitempty"`
+	Warnings []string      `json:"warnings,omitempty"`
+	Status   *DaemonStatus `json:"status,omitempty"`
+}
+
+// ControlHandler handles a control request
+type ControlHandler func(request *ControlRequest) *ControlResponse
+
+// DaemonStatus is the status of the daemon
+type DaemonStatus struct {
+	PID        int                 `json:"pid"`
+	Version    commons.VersionInfo `json:"version"`
+	StartTime  time.Time           `json:"start_time"`
+	ReloadTime *time.Time          `json:"reload_time,omitempty"`
+	Uptime     string              `json:"uptime"`
+	*ServiceStatus
+	Errors []RecentError `json:"errors"`
+}
+
+// ServiceStatus is the status of the service running in the daemon
+type ServiceStatus struct {
+	Terminating   bool                       `json:"terminating,omitempty"`
+	DryRun        bool                       `json:"dry_run,omitempty"`
+	Queue         string                     `json:"queue,omitempty"`
+	AMQPPaused    bool                       `json:"amqp_paused,omitempty"`
+	InFlight      int64                      `json:"in_flight"`
+	RetryQueue    int                        `json:"retry_queue"`
+	PendingEvents int                        `json:"pending_events"`
+	Components    map[string]ComponentHealth `json:"components"`
+}
+
+// Status returns the status of the service
+func (svc *PurgemanService) Status() *ServiceStatus {
+	svc.Mutex.Lock()
+	terminating := svc.Terminate
+	queue := ""
+	if svc.MessageQueueConnection != nil {
+		// the name of the queue declared
+		queue = svc.MessageQueueConnection.Config.Queue
+	}
+	svc.Mutex.Unlock()
+
+	return &ServiceStatus{
+		Terminating:   terminating,
+		DryRun:        svc.Config.DryRun,
+		Queue:         queue,
+		AMQPPaused:    svc.AMQPPause.IsPaused(),
+		InFlight:      atomic.LoadInt64(&svc.InFlight),
+		RetryQueue:    svc.RetryQueue.Len(),
+		PendingEvents: svc.PendingEvents.Len(),
+		Components:    svc.Health.Snapshot(),
+	}
+}
+
+// RecentError is an error logged
+type RecentError struct {
+	Time     time.Time `json:"time"`
+	Function string    `json:"function,omitempty"`
+	Message  string    `json:"message"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// RecentErrors is a logrus hook keeping recent errors logged
+type RecentErrors struct {
+	MaxSize int
+
+	errors []RecentError
+	mutex  sync.Mutex
+}
+
+// NewRecentErrors creates a new RecentErrors
+func NewRecentErrors(maxSize int) *RecentErrors {
+	return &RecentErrors{
+		MaxSize: maxSize,
+		errors:  []RecentError{},
+	}
+}
+
+// Levels returns log levels kept
+func (recent *RecentErrors) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel}
+}
+
+// Fire keeps the log entry
+func (recent *RecentErrors) Fire(entry *log.Entry) error {
+	recentError := RecentError{
+		Time:    entry.Time,
+		Message: entry.Message,
+	}
+
+	if function, ok := entry.Data["function"].(string); ok {
+		recentError.Function = function
+	}
+
+	if err, ok := entry.Data[log.ErrorKey].(error); ok {
+		recentError.Error = err.Error()
+	}
+
+	recent.mutex.Lock()
+	defer recent.mutex.Unlock()
+
+	recent.errors = append(recent.errors, recentError)
+	if len(recent.errors) > recent.MaxSize {
+		recent.errors = recent.errors[len(recent.errors)-recent.MaxSize:]
+	}
+	return nil
+}
+
+// Get returns recent errors, oldest first
+func (recent *RecentErrors) Get() []RecentError {
+	recent.mutex.Lock()
+	defer recent.mutex.Unlock()
+
+	errors := make([]RecentError, len(recent.errors))
+	copy(errors, recent.errors)
+	return errors
+}
+
+// ControlServer serves control requests on a Unix socket, one request per connection
+type ControlServer struct {
+	Path string
+
+	listener net.Listener
+	handler  ControlHandler
+	wg       sync.WaitGroup
+}
+
+// NewControlServer listens on the Unix socket, a stale socket left by a daemon terminated is replaced
+func NewControlServer(path string, handler ControlHandler) (*ControlServer, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"function": "NewControlServer",
+	})
+
+	fileinfo, err := os.Lstat(path)
+	if err == nil {
+		if fileinfo.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("control socket path %s exists and is not a socket", path)
+		}
+
+		conn, err := net.DialTimeout("unix", path, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another purgeman is listening on control socket %s", path)
+		}
+
+		logger.Infof("Removing a stale control socket %s", path)
+		err = os.Remove(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove a stale control socket %s - %v", path, err)
+		}
+	}
+
+	// the socket is created with the mode, so it is never accessible to others even for a moment
+	oldUmask := syscall.Umask(int(^ControlSocketMode & os.ModePerm))
+	listener, err := net.Listen("unix", path)
+	syscall.Umask(oldUmask)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket %s - %v", path, err)
+	}
+
+	return &ControlServer{
+		Path:     path,
+		listener: listener,
+		handler:  handler,
+	}, nil
+}
+
+// Serve accepts control requests, returns when the server is closed
+func (server *ControlServer) Serve() {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "ControlServer",
+		"function": "Serve",
+	})
+
+	logger.Infof("Serving control requests on %s", server.Path)
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				continue
+			}
+			return
+		}
+
+		server.wg.Add(1)
+		go func(conn net.Conn) {
+			defer server.wg.Done()
+			server.handleConnection(conn)
+		}(conn)
+	}
+}
+
+// Close stops accepting requests, waits for requests in progress, and removes the socket
+func (server *ControlServer) Close() {
+	server.listener.Close()
+	server.wg.Wait()
+}
+
+func (server *ControlServer) handleConnection(conn net.Conn) {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "ControlServer",
+		"function": "handleConnection",
+	})
+
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ControlTimeout))
+
+	request := ControlRequest{}
+	err := json.NewDecoder(conn).Decode(&request)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to read a control request")
+		return
+	}
+
+	logger.Infof("Handling a control request %s", request.Command)
+	response := server.handler(&request)
+
+	err = json.NewEncoder(conn).Encode(response)
+	if err != nil {
+		logger.WithError(err).Warnf("Failed to write a response to a control request %s", request.Command)
+	}
+}
+
+// checkControlSocketOwner checks if the socket is owned by the current user or root
+// requests may carry secrets, so they must not be sent to a socket created by someone else
+func checkControlSocketOwner(path string) error {
+	fileinfo, err := os.Lstat(path)
+	if err != nil {
+		return fmt.Errorf("failed to access control socket %s, is purgeman running? - %v", path, err)
+	}
+
+	if fileinfo.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("control socket path %s is not a socket", path)
+	}
+
+	stat, ok := fileinfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("failed to find the owner of control socket %s", path)
+	}
+
+	uid := os.Getuid()
+	if int(stat.Uid) != uid && stat.Uid != 0 {
+		return fmt.Errorf("control socket %s is owned by uid %d, not by the current user (uid %d) or root", path, stat.Uid, uid)
+	}
+	return nil
+}
+
+// SendControlRequest sends the request to the daemon listening on the control socket
+// the socket must be owned by the current user or root
+func SendControlRequest(path string, request *ControlRequest) (*ControlResponse, error) {
+	err := checkControlSocketOwner(path)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("unix", path, ControlTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to control socket %s, is purgeman running? - %v", path, err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(ControlTimeout))
+
+	err = json.NewEncoder(conn).Encode(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send a control request - %v", err)
+	}
+
+	response := ControlResponse{}
+	err = json.NewDecoder(conn).Decode(&response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read a control response - %v", err)
+	}
+
+	if len(response.Error) > 0 {
+		return &response, fmt.Errorf("%s", response.Error)
+	}
+
+	return &response, nil
+}
@@ -0,0 +1,110 @@
+package purgeman
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestControlServerRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "purgeman-control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socketPath := filepath.Join(dir, "control.sock")
+	server, err := NewControlServer(socketPath, func(request *ControlRequest) *ControlResponse {
+		if request.Command != ControlCommandStatus {
+			return &ControlResponse{
+				Error: fmt.Sprintf("unknown control command %s", request.Command),
+			}
+		}
+
+		return &ControlResponse{
+			Status: &DaemonStatus{
+				PID:           1234,
+				ServiceStatus: &ServiceStatus{},
+			},
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to create a control server - %v", err)
+	}
+	go server.Serve()
+	defer server.Close()
+
+	fileinfo, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fileinfo.Mode().Perm() != ControlSocketMode {
+		t.Errorf("expected socket mode %o, got %o", ControlSocketMode, fileinfo.Mode().Perm())
+	}
+
+	response, err := SendControlRequest(socketPath, &ControlRequest{Command: ControlCommandStatus})
+	if err != nil {
+		t.Fatalf("failed to send a control request - %v", err)
+	}
+
+	if response.Status == nil || response.Status.PID != 1234 {
+		t.Errorf("unexpected status %+v", response.Status)
+	}
+
+	_, err = SendControlRequest(socketPath, &ControlRequest{Command: "unknown"})
+	if err == nil {
+		t.Errorf("expected an error for an unknown command")
+	}
+
+	// a second server must not take over the socket in use
+	_, err = NewControlServer(socketPath, nil)
+	if err == nil {
+		t.Errorf("expected an error for a socket in use")
+	}
+}
+
+func TestSendControlRequestRejectsNonSocket(t *testing.T) {
+	file, err := ioutil.TempFile("", "purgeman-control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	_, err = SendControlRequest(file.Name(), &ControlRequest{Command: ControlCommandStatus})
+	if err == nil {
+		t.Errorf("expected an error for a path that is not a socket")
+	}
+}
+
+func TestRecentErrorsKeepsLatest(t *testing.T) {
+	recent := NewRecentErrors(2)
+
+	for idx := 0; idx < 3; idx++ {
+		recent.Fire(&log.Entry{
+			Message: fmt.Sprintf("error %d", idx),
+			Data: log.Fields{
+				"function":   "test",
+				log.ErrorKey: fmt.Errorf("cause %d", idx),
+			},
+		})
+	}
+
+	errors := recent.Get()
+	if len(errors) != 2 {
+		t.Fatalf("expected 2 errors, got %d", len(errors))
+	}
+
+	if errors[0].Message != "error 1" || errors[1].Message != "error 2" {
+		t.Errorf("expected the latest errors, got %+v", errors)
+	}
+
+	if errors[1].Function != "test" || errors[1].Error != "cause 2" {
+		t.Errorf("unexpected fields %+v", errors[1])
+	}
+}
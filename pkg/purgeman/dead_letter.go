@@ -0,0 +1,54 @@
+package purgeman
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeadLetter is a record of an event that could not be handled
+type DeadLetter struct {
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+	Event  *FSEvent  `json:"event"`
+}
+
+// DeadLetterWriter appends dead letters to a file in JSON lines format
+type DeadLetterWriter struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+// NewDeadLetterWriter creates a new DeadLetterWriter
+func NewDeadLetterWriter(path string) *DeadLetterWriter {
+	return &DeadLetterWriter{
+		Path: path,
+	}
+}
+
+// Write appends a dead letter for the event
+func (writer *DeadLetterWriter) Write(event *FSEvent, reason string) error {
+	letter := DeadLetter{
+		Time:   time.Now(),
+		Reason: reason,
+		Event:  event,
+	}
+
+	letterBytes, err := json.Marshal(&letter)
+	if err != nil {
+		return err
+	}
+
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	file, err := os.OpenFile(writer.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(letterBytes, '\n'))
+	return err
+}
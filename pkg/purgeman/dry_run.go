@@ -0,0 +1,80 @@
+package purgeman
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PurgePlan is a record of a purge request planned in dry-run mode
+type PurgePlan struct {
+	Time    time.Time         `json:"time"`
+	Target  string            `json:"target"`
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Host    string            `json:"host"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// DryRunWriter records purge plans in JSON lines format
+// plans are appended to a file, written to stdout if the path is "-", or logged if the path is empty
+type DryRunWriter struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+// NewDryRunWriter creates a new DryRunWriter
+func NewDryRunWriter(path string) *DryRunWriter {
+	return &DryRunWriter{
+		Path: path,
+	}
+}
+
+// Write records a purge plan
+func (writer *DryRunWriter) Write(plan *PurgePlan) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "DryRunWriter",
+		"function": "Write",
+	})
+
+	// keep redacted values readable
+	planBuffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(planBuffer)
+	encoder.SetEscapeHTML(false)
+
+	err := encoder.Encode(plan)
+	if err != nil {
+		return err
+	}
+
+	// the encoder appends a newline
+	planBytes := planBuffer.Bytes()
+
+	if len(writer.Path) == 0 {
+		logger.Infof("Dry run: %s", strings.TrimSpace(string(planBytes)))
+		return nil
+	}
+
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.Path == "-" {
+		_, err = os.Stdout.Write(planBytes)
+		return err
+	}
+
+	file, err := os.OpenFile(writer.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(planBytes)
+	return err
+}
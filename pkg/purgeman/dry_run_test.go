@@ -0,0 +1,83 @@
+package purgeman
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+)
+
+func TestDryRunRedactsHeaderValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "purgeman-dryrun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	planPath := filepath.Join(dir, "plans.jsonl")
+	svc, received := newTestService(t, func(config *commons.Config) {
+		config.DryRun = true
+		config.DryRunPath = planPath
+		config.Targets[0].Auth = commons.TargetAuthConfig{
+			Type:  commons.TargetAuthBearer,
+			Token: "bearer-secret",
+		}
+		config.Targets[0].Variants = []commons.URLVariant{
+			{
+				Headers: map[string]string{
+					"Cookie": "session=secret",
+				},
+			},
+		}
+	})
+
+	results := svc.PurgePaths([]string{"/iplant/home/user/a.txt"}, false, "")
+	if len(results) == 0 {
+		t.Fatal("expected purge results")
+	}
+
+	if paths := received(); len(paths) != 0 {
+		t.Errorf("expected no requests in dry-run mode, got %v", paths)
+	}
+
+	planBytes, err := ioutil.ReadFile(planPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(planBytes), "secret") {
+		t.Errorf("expected header values to be redacted, got %s", planBytes)
+	}
+
+	cookies := 0
+	lines := strings.Split(strings.TrimSpace(string(planBytes)), "\n")
+	for _, line := range lines {
+		plan := PurgePlan{}
+		err = json.Unmarshal([]byte(line), &plan)
+		if err != nil {
+			t.Fatalf("failed to parse a plan %s - %v", line, err)
+		}
+
+		if plan.Headers["Authorization"] != commons.RedactedValue {
+			t.Errorf("expected the authorization header to be recorded and redacted, got %v", plan.Headers)
+		}
+
+		if cookie, ok := plan.Headers["Cookie"]; ok {
+			cookies++
+			if cookie != commons.RedactedValue {
+				t.Errorf("expected the cookie header to be redacted, got %s", cookie)
+			}
+		}
+	}
+
+	// the base request and the variant
+	if len(lines) != 2 || cookies != 1 {
+		t.Errorf("expected 2 plans with a variant, got %d plans with %d variants", len(lines), cookies)
+	}
+}
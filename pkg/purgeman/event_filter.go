@@ -0,0 +1,128 @@
+package purgeman
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+)
+
+// eventFilterRule is a compiled commons.EventFilterRule
+type eventFilterRule struct {
+	Name   string
+	Events []string
+	Fields map[string]*regexp.Regexp
+}
+
+// EventFilter ignores events matching filter rules
+type EventFilter struct {
+	rules   []*eventFilterRule
+	skipped map[string]uint64
+	mutex   sync.Mutex
+}
+
+// NewEventFilter creates a new EventFilter
+func NewEventFilter(rules []commons.EventFilterRule) (*EventFilter, error) {
+	filter := &EventFilter{
+		skipped: map[string]uint64{},
+	}
+
+	for idx := range rules {
+		rule := &rules[idx]
+
+		err := rule.Validate()
+		if err != nil {
+			return nil, err
+		}
+
+		compiledRule := &eventFilterRule{
+			Name:   rule.Name,
+			Events: rule.Events,
+			Fields: map[string]*regexp.Regexp{},
+		}
+
+		for field, pattern := range rule.Fields {
+			regex, err := commons.CompileValuePattern(pattern)
+			if err != nil {
+				return nil, err
+			}
+			compiledRule.Fields[field] = regex
+		}
+
+		filter.rules = append(filter.rules, compiledRule)
+	}
+
+	return filter, nil
+}
+
+// Ignores checks if the event matches any of filter rules, returns the name of the matching rule
+// matching events are counted
+func (filter *EventFilter) Ignores(event *FSEvent) (string, bool) {
+	for _, rule := range filter.rules {
+		if rule.matches(event) {
+			filter.mutex.Lock()
+			filter.skipped[rule.Name]++
+			filter.mutex.Unlock()
+
+			return rule.Name, true
+		}
+	}
+
+	return "", false
+}
+
+// Stats returns the number of ignored events for each rule
+func (filter *EventFilter) Stats() map[string]uint64 {
+	filter.mutex.Lock()
+	defer filter.mutex.Unlock()
+
+	stats := map[string]uint64{}
+	for name, count := range filter.skipped {
+		stats[name] = count
+	}
+	return stats
+}
+
+// RuleNames returns names of filter rules in order
+func (filter *EventFilter) RuleNames() []string {
+	names := []string{}
+	for _, rule := range filter.rules {
+		names = append(names, rule.Name)
+	}
+	return names
+}
+
+func (rule *eventFilterRule) matches(event *FSEvent) bool {
+	if len(rule.Events) > 0 {
+		matched := false
+		for _, eventPattern := range rule.Events {
+			ok, err := path.Match(eventPattern, event.EventType)
+			if err == nil && ok {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	// sort fields to evaluate in the same order every time
+	fields := make([]string, 0, len(rule.Fields))
+	for field := range rule.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		value, ok := getBodyValueString(event.Body, field)
+		if !ok || !rule.Fields[field].MatchString(value) {
+			return false
+		}
+	}
+
+	return true
+}
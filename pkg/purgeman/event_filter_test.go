@@ -0,0 +1,89 @@
+package purgeman
+
+import (
+	"testing"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+)
+
+func TestEventFilterIgnores(t *testing.T) {
+	filter, err := NewEventFilter([]commons.EventFilterRule{
+		{
+			Name:   "replication",
+			Events: []string{"data-object.sys-metadata.mod"},
+			Fields: map[string]string{"author.name": "svc_*"},
+		},
+		{
+			Name:   "bots",
+			Fields: map[string]string{"author.name": "regex:^(bot|de-archive)$"},
+		},
+		{
+			Name:   "collections",
+			Events: []string{"collection.*"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newEvent := func(eventType string, author string) *FSEvent {
+		return &FSEvent{
+			EventType: eventType,
+			Body: map[string]interface{}{
+				"author": map[string]interface{}{
+					"name": author,
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		event   *FSEvent
+		rule    string
+		ignored bool
+	}{
+		{"event and field", newEvent("data-object.sys-metadata.mod", "svc_replicator"), "replication", true},
+		{"event without field", newEvent("data-object.sys-metadata.mod", "user"), "", false},
+		{"field without event", newEvent("data-object.mod", "svc_replicator"), "", false},
+		{"regex field", newEvent("data-object.add", "de-archive"), "bots", true},
+		{"regex is anchored", newEvent("data-object.add", "robot"), "", false},
+		{"event glob", newEvent("collection.rm", "user"), "collections", true},
+		{"missing field", &FSEvent{EventType: "data-object.add"}, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule, ignored := filter.Ignores(test.event)
+			if ignored != test.ignored || rule != test.rule {
+				t.Errorf("expected %q (%t), got %q (%t)", test.rule, test.ignored, rule, ignored)
+			}
+		})
+	}
+
+	stats := filter.Stats()
+	if stats["replication"] != 1 || stats["bots"] != 1 || stats["collections"] != 1 {
+		t.Errorf("unexpected stats %v", stats)
+	}
+}
+
+func TestNewEventFilterRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule commons.EventFilterRule
+	}{
+		{"matches all events", commons.EventFilterRule{Name: "all"}},
+		{"invalid event pattern", commons.EventFilterRule{Events: []string{"["}}},
+		{"invalid regex", commons.EventFilterRule{Fields: map[string]string{"author.name": "regex:("}}},
+		{"empty field name", commons.EventFilterRule{Fields: map[string]string{"": "bot"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewEventFilter([]commons.EventFilterRule{test.rule})
+			if err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
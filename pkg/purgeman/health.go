@@ -0,0 +1,155 @@
+package purgeman
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// TargetComponentPrefix is a prefix of health component names of purge targets
+	TargetComponentPrefix string = "target:"
+)
+
+// ComponentHealth is a health state of a component
+type ComponentHealth struct {
+	Healthy       bool       `json:"healthy"`
+	Detail        string     `json:"detail,omitempty"`
+	Since         time.Time  `json:"since"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+}
+
+// HealthReport is a response body of health endpoints
+type HealthReport struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentHealth `json:"components"`
+}
+
+// HealthTracker tracks health states of components
+type HealthTracker struct {
+	components map[string]*ComponentHealth
+	mutex      sync.Mutex
+}
+
+// NewHealthTracker creates a new HealthTracker
+func NewHealthTracker() *HealthTracker {
+	return &HealthTracker{
+		components: map[string]*ComponentHealth{},
+	}
+}
+
+// methods below do nothing on nil tracker, so components can be used without health tracking
+
+// Set sets the health state of the component, the last error is kept
+func (tracker *HealthTracker) Set(component string, healthy bool, detail string) {
+	if tracker == nil {
+		return
+	}
+
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	health := tracker.getComponent(component)
+	if health.Healthy != healthy || health.Since.IsZero() {
+		health.Since = time.Now()
+	}
+
+	health.Healthy = healthy
+	health.Detail = detail
+}
+
+// SetError marks the component unhealthy with the error
+func (tracker *HealthTracker) SetError(component string, err error) {
+	if tracker == nil || err == nil {
+		return
+	}
+
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	now := time.Now()
+
+	health := tracker.getComponent(component)
+	if health.Healthy || health.Since.IsZero() {
+		health.Since = now
+	}
+
+	health.Healthy = false
+	health.Detail = ""
+	health.LastError = err.Error()
+	health.LastErrorTime = &now
+}
+
+// Snapshot returns copies of health states of all components
+func (tracker *HealthTracker) Snapshot() map[string]ComponentHealth {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	snapshot := map[string]ComponentHealth{}
+	for name, health := range tracker.components {
+		snapshot[name] = *health
+	}
+	return snapshot
+}
+
+func (tracker *HealthTracker) getComponent(component string) *ComponentHealth {
+	health, ok := tracker.components[component]
+	if !ok {
+		health = &ComponentHealth{}
+		tracker.components[component] = health
+	}
+	return health
+}
+
+// isReady checks if the service is consuming events
+// the AMQP consumer and the iRODS session must be healthy, and at least one purge target must be reachable
+func isReady(components map[string]ComponentHealth) bool {
+	if !components[ComponentAMQP].Healthy || !components[ComponentIRODS].Healthy {
+		return false
+	}
+
+	for name, health := range components {
+		if strings.HasPrefix(name, TargetComponentPrefix) && health.Healthy {
+			return true
+		}
+	}
+	return false
+}
+
+// handleHealthz responds if the service is alive
+func (svc *PurgemanService) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	status := "ok"
+	statusCode := http.StatusOK
+	if svc.isTerminated() {
+		status = "terminating"
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	writeHealthReport(w, statusCode, &HealthReport{
+		Status:     status,
+		Components: svc.Health.Snapshot(),
+	})
+}
+
+// handleReadyz responds if the service is ready to consume events
+func (svc *PurgemanService) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	components := svc.Health.Snapshot()
+
+	status := "ready"
+	statusCode := http.StatusOK
+	if svc.isTerminated() || !isReady(components) {
+		status = "not ready"
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	writeHealthReport(w, statusCode, &HealthReport{
+		Status:     status,
+		Components: components,
+	})
+}
+
+func writeHealthReport(w http.ResponseWriter, statusCode int, report *HealthReport) {
+	writeJSON(w, statusCode, report)
+}
@@ -0,0 +1,65 @@
+package purgeman
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// HTTPShutdownTimeout is a timeout to wait for HTTP requests in progress on termination
+	HTTPShutdownTimeout = 5 * time.Second
+)
+
+// runHTTPServer serves metrics, health endpoints and the admin API, returns when the server is stopped
+func (svc *PurgemanService) runHTTPServer() error {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgemanService",
+		"function": "runHTTPServer",
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(svc.Metrics.Registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", svc.handleHealthz)
+	mux.HandleFunc("/readyz", svc.handleReadyz)
+
+	if len(svc.Config.AdminToken) > 0 {
+		svc.registerAdminAPI(mux)
+	}
+
+	server := &http.Server{
+		Addr:    svc.Config.HTTPListen,
+		Handler: mux,
+	}
+
+	svc.Mutex.Lock()
+	if svc.Terminate {
+		svc.Mutex.Unlock()
+		return nil
+	}
+	svc.HTTPServer = server
+	svc.Mutex.Unlock()
+
+	logger.Infof("Serving HTTP on %s", svc.Config.HTTPListen)
+	err := server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// stopHTTPServer stops the HTTP server, it waits for requests in progress up to HTTPShutdownTimeout
+func stopHTTPServer(server *http.Server) {
+	if server == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), HTTPShutdownTimeout)
+	defer cancel()
+
+	server.Shutdown(ctx)
+}
@@ -0,0 +1,137 @@
+package purgeman
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// monitorIRODS keeps the iRODS session healthy, returns when the service is terminated
+// it reconnects when the session is broken, and replays pending events when connected
+func (svc *PurgemanService) monitorIRODS() {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgemanService",
+		"function": "monitorIRODS",
+	})
+
+	connectedBefore := false
+	for !svc.isTerminated() {
+		if svc.getIRODSClient() == nil {
+			err := svc.connectIRODS()
+			if err != nil {
+				svc.Health.SetError(ComponentIRODS, err)
+				logger.WithError(err).Errorf("Failed to connect to iRODS, retry after %s", svc.Config.IRODSReconnectInterval)
+				svc.sleep(svc.Config.IRODSReconnectInterval)
+				continue
+			}
+
+			logger.Info("Connected to iRODS")
+			svc.Health.Set(ComponentIRODS, true, "connected")
+			svc.Metrics.SetConnected(ComponentIRODS, true)
+			if connectedBefore {
+				svc.Metrics.Reconnected(ComponentIRODS)
+			}
+			connectedBefore = true
+
+			go svc.replayPendingEvents()
+		} else {
+			err := svc.checkIRODS()
+			if err != nil {
+				svc.Health.SetError(ComponentIRODS, err)
+				logger.WithError(err).Error("iRODS session is broken, reconnecting")
+				svc.disconnectIRODS()
+				continue
+			}
+		}
+
+		svc.sleep(svc.Config.IRODSHealthCheckInterval)
+	}
+}
+
+// checkIRODS checks if the iRODS session works
+func (svc *PurgemanService) checkIRODS() error {
+	fsClient := svc.getIRODSClient()
+	if fsClient == nil {
+		return fmt.Errorf("not connected to iRODS")
+	}
+
+	conn, err := fsClient.Session.AcquireConnection()
+	if err != nil {
+		return err
+	}
+	defer fsClient.Session.ReturnConnection(conn)
+
+	return pingIRODS(conn, fmt.Sprintf("/%s", svc.Config.IRODSZone))
+}
+
+// disconnectIRODS releases the iRODS session, lookups in progress fail on their own
+func (svc *PurgemanService) disconnectIRODS() {
+	svc.IRODSMutex.Lock()
+	fsClient := svc.IRODSClient
+	svc.IRODSClient = nil
+	svc.IRODSMutex.Unlock()
+
+	if fsClient != nil {
+		fsClient.Release()
+	}
+
+	svc.Metrics.SetConnected(ComponentIRODS, false)
+}
+
+// isIRODSAvailable returns true if the iRODS session is available
+func (svc *PurgemanService) isIRODSAvailable() bool {
+	return svc.getIRODSClient() != nil
+}
+
+// bufferPendingEvent keeps the event until iRODS becomes available
+func (svc *PurgemanService) bufferPendingEvent(event *FSEvent) {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgemanService",
+		"function": "bufferPendingEvent",
+	})
+
+	err := svc.PendingEvents.Push(event)
+	if err != nil {
+		svc.deadLetterEvent(event, fmt.Sprintf("iRODS is not available and failed to buffer - %v", err))
+		return
+	}
+
+	logger.Infof("iRODS is not available, buffered a %s event on file UUID %s", event.EventType, event.UUID)
+}
+
+// replayPendingEvents handles events buffered while iRODS was not available
+func (svc *PurgemanService) replayPendingEvents() {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgemanService",
+		"function": "replayPendingEvents",
+	})
+
+	pending := svc.PendingEvents.Len()
+	if pending == 0 {
+		return
+	}
+
+	logger.Infof("Replaying %d events buffered while iRODS was not available", pending)
+
+	// handle events in parallel, but not more than the number of iRODS connections
+	slots := make(chan struct{}, svc.Config.IRODSConnectionMax)
+	err := svc.PendingEvents.Drain(func(event *FSEvent) {
+		event.Replayed = true
+
+		slots <- struct{}{}
+		go func() {
+			defer func() {
+				<-slots
+			}()
+
+			svc.fsEventHandler(event)
+		}()
+	})
+
+	if err != nil {
+		logger.WithError(err).Error("Failed to replay buffered events")
+	}
+}
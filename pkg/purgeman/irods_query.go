@@ -0,0 +1,148 @@
+package purgeman
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/cyverse/go-irodsclient/irods/common"
+	"github.com/cyverse/go-irodsclient/irods/connection"
+	irodsfs_clientirodsfs "github.com/cyverse/go-irodsclient/irods/fs"
+	"github.com/cyverse/go-irodsclient/irods/message"
+	"github.com/cyverse/go-irodsclient/irods/types"
+)
+
+// queryIRODSPathsByID returns paths of data objects or collections with the given id using GenQuery
+func queryIRODSPathsByID(conn *connection.IRODSConnection, id string, isCollection bool) ([]string, error) {
+	if conn == nil || !conn.IsConnected() {
+		return nil, fmt.Errorf("connection is nil or disconnected")
+	}
+
+	// id must be a number, this also prevents query injection
+	_, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse id - %s", id)
+	}
+
+	paths := []string{}
+
+	continueQuery := true
+	continueIndex := 0
+	for continueQuery {
+		query := message.NewIRODSMessageQuery(common.MaxQueryRows, continueIndex, 0, 0)
+		query.AddSelect(common.ICAT_COLUMN_COLL_NAME, 1)
+
+		condVal := fmt.Sprintf("= '%s'", id)
+		if isCollection {
+			query.AddCondition(common.ICAT_COLUMN_COLL_ID, condVal)
+		} else {
+			query.AddSelect(common.ICAT_COLUMN_DATA_NAME, 1)
+			query.AddCondition(common.ICAT_COLUMN_D_DATA_ID, condVal)
+		}
+
+		queryResult := message.IRODSMessageQueryResult{}
+		err := conn.Request(query, &queryResult)
+		if err != nil {
+			return nil, fmt.Errorf("could not receive a query result message - %v", err)
+		}
+
+		err = queryResult.CheckError()
+		if err != nil {
+			if types.GetIRODSErrorCode(err) == common.CAT_NO_ROWS_FOUND {
+				// empty
+				return paths, nil
+			}
+
+			return nil, fmt.Errorf("received a query error - %v", err)
+		}
+
+		if queryResult.RowCount == 0 {
+			break
+		}
+
+		if queryResult.AttributeCount > len(queryResult.SQLResult) {
+			return nil, fmt.Errorf("could not receive attributes - requires %d, but received %d attributes", queryResult.AttributeCount, len(queryResult.SQLResult))
+		}
+
+		collNames := make([]string, queryResult.RowCount)
+		dataNames := make([]string, queryResult.RowCount)
+
+		for attr := 0; attr < queryResult.AttributeCount; attr++ {
+			sqlResult := queryResult.SQLResult[attr]
+			if len(sqlResult.Values) != queryResult.RowCount {
+				return nil, fmt.Errorf("could not receive rows - requires %d, but received %d attributes", queryResult.RowCount, len(sqlResult.Values))
+			}
+
+			for row := 0; row < queryResult.RowCount; row++ {
+				switch sqlResult.AttributeIndex {
+				case int(common.ICAT_COLUMN_COLL_NAME):
+					collNames[row] = sqlResult.Values[row]
+				case int(common.ICAT_COLUMN_DATA_NAME):
+					dataNames[row] = sqlResult.Values[row]
+				default:
+					// ignore
+				}
+			}
+		}
+
+		for row := 0; row < queryResult.RowCount; row++ {
+			if isCollection {
+				paths = append(paths, collNames[row])
+			} else {
+				paths = append(paths, path.Join(collNames[row], dataNames[row]))
+			}
+		}
+
+		continueIndex = queryResult.ContinueIndex
+		if continueIndex == 0 {
+			continueQuery = false
+		}
+	}
+
+	return paths, nil
+}
+
+// pingIRODS checks if the connection works by querying the collection
+func pingIRODS(conn *connection.IRODSConnection, collectionPath string) error {
+	if conn == nil || !conn.IsConnected() {
+		return fmt.Errorf("connection is nil or disconnected")
+	}
+
+	query := message.NewIRODSMessageQuery(1, 0, 0, 0)
+	query.AddSelect(common.ICAT_COLUMN_COLL_ID, 1)
+	query.AddCondition(common.ICAT_COLUMN_COLL_NAME, fmt.Sprintf("= '%s'", collectionPath))
+
+	queryResult := message.IRODSMessageQueryResult{}
+	err := conn.Request(query, &queryResult)
+	if err != nil {
+		return fmt.Errorf("could not receive a query result message - %v", err)
+	}
+
+	err = queryResult.CheckError()
+	if err != nil && types.GetIRODSErrorCode(err) != common.CAT_NO_ROWS_FOUND {
+		return fmt.Errorf("received a query error - %v", err)
+	}
+
+	return nil
+}
+
+// queryIRODSAccesses returns accesses of a collection or a data object at the path
+// this does not use the file system cache, so changes made just before are visible
+// returns an empty list if nothing exists at the path
+func queryIRODSAccesses(conn *connection.IRODSConnection, irodsPath string) ([]*types.IRODSAccess, error) {
+	accesses, err := irodsfs_clientirodsfs.ListCollectionAccess(conn, irodsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(accesses) > 0 {
+		return accesses, nil
+	}
+
+	// collections always have an owner, so this may be a data object
+	collection := &types.IRODSCollection{
+		Path: path.Dir(irodsPath),
+	}
+
+	return irodsfs_clientirodsfs.ListDataObjectAccess(conn, collection, path.Base(irodsPath))
+}
@@ -0,0 +1,64 @@
+package purgeman
+
+import (
+	"sync"
+	"time"
+)
+
+// LagTracker tracks how far behind the consumption of events is
+type LagTracker struct {
+	lastLag       time.Duration
+	maxLag        time.Duration
+	droppedEvents uint64
+	mutex         sync.Mutex
+}
+
+// NewLagTracker creates a new LagTracker
+func NewLagTracker() *LagTracker {
+	return &LagTracker{}
+}
+
+// Observe records the lag of an event
+func (tracker *LagTracker) Observe(lag time.Duration) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	tracker.lastLag = lag
+	if lag > tracker.maxLag {
+		tracker.maxLag = lag
+	}
+}
+
+// Drop counts an event dropped due to its age
+func (tracker *LagTracker) Drop() {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	tracker.droppedEvents++
+}
+
+// Stats returns the last lag, the max lag since the last call and the number of dropped events
+func (tracker *LagTracker) Stats() (time.Duration, time.Duration, uint64) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	maxLag := tracker.maxLag
+	tracker.maxLag = 0
+	return tracker.lastLag, maxLag, tracker.droppedEvents
+}
+
+// LastLag returns the lag of the last event
+func (tracker *LagTracker) LastLag() time.Duration {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	return tracker.lastLag
+}
+
+// Dropped returns the number of events dropped due to their age
+func (tracker *LagTracker) Dropped() uint64 {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	return tracker.droppedEvents
+}
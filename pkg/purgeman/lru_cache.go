@@ -0,0 +1,163 @@
+package purgeman
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruCacheEntry is an entry of LRUCache
+type lruCacheEntry struct {
+	Key        string
+	Value      interface{}
+	ExpireTime time.Time
+}
+
+// LRUCache is a LRU cache whose entries expire after TTL
+// typed caches wrap it, values are not copied
+type LRUCache struct {
+	MaxSize int
+	TTL     time.Duration
+
+	entries map[string]*list.Element
+	lru     *list.List
+	hits    uint64
+	misses  uint64
+	mutex   sync.Mutex
+}
+
+// NewLRUCache creates a new LRUCache
+func NewLRUCache(maxSize int, ttl time.Duration) *LRUCache {
+	return &LRUCache{
+		MaxSize: maxSize,
+		TTL:     ttl,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// Get returns a value cached for the key, expired entries are removed
+func (cache *LRUCache) Get(key string) (interface{}, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if elem, ok := cache.entries[key]; ok {
+		entry := elem.Value.(*lruCacheEntry)
+		if time.Now().Before(entry.ExpireTime) {
+			cache.lru.MoveToFront(elem)
+			cache.hits++
+			return entry.Value, true
+		}
+
+		// expired
+		cache.removeElement(elem)
+	}
+
+	cache.misses++
+	return nil, false
+}
+
+// Put adds or updates a value for the key, the TTL starts again
+// the least recently used entries are evicted when the cache is full
+func (cache *LRUCache) Put(key string, value interface{}) {
+	if cache.MaxSize <= 0 || len(key) == 0 {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	expireTime := time.Now().Add(cache.TTL)
+
+	if elem, ok := cache.entries[key]; ok {
+		entry := elem.Value.(*lruCacheEntry)
+		entry.Value = value
+		entry.ExpireTime = expireTime
+		cache.lru.MoveToFront(elem)
+		return
+	}
+
+	elem := cache.lru.PushFront(&lruCacheEntry{
+		Key:        key,
+		Value:      value,
+		ExpireTime: expireTime,
+	})
+	cache.entries[key] = elem
+
+	for cache.lru.Len() > cache.MaxSize {
+		cache.removeElement(cache.lru.Back())
+	}
+}
+
+// Remove evicts the key from the cache
+func (cache *LRUCache) Remove(key string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if elem, ok := cache.entries[key]; ok {
+		cache.removeElement(elem)
+	}
+}
+
+// Update calls the function for each entry, and replaces values of entries the function returns true for
+// neither the TTL nor the order of entries changes
+func (cache *LRUCache) Update(fn func(key string, value interface{}) (interface{}, bool)) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	for elem := cache.lru.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*lruCacheEntry)
+		if newValue, ok := fn(entry.Key, entry.Value); ok {
+			entry.Value = newValue
+		}
+	}
+}
+
+// RemoveIf evicts entries the function returns true for
+func (cache *LRUCache) RemoveIf(fn func(key string, value interface{}) bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	elem := cache.lru.Front()
+	for elem != nil {
+		next := elem.Next()
+		entry := elem.Value.(*lruCacheEntry)
+		if fn(entry.Key, entry.Value) {
+			cache.removeElement(elem)
+		}
+		elem = next
+	}
+}
+
+// Len returns the number of entries in the cache, expired entries are removed and not counted
+func (cache *LRUCache) Len() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	now := time.Now()
+	elem := cache.lru.Front()
+	for elem != nil {
+		next := elem.Next()
+		entry := elem.Value.(*lruCacheEntry)
+		if !now.Before(entry.ExpireTime) {
+			cache.removeElement(elem)
+		}
+		elem = next
+	}
+
+	return cache.lru.Len()
+}
+
+// Stats returns the number of cache hits and misses
+func (cache *LRUCache) Stats() (uint64, uint64) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return cache.hits, cache.misses
+}
+
+func (cache *LRUCache) removeElement(elem *list.Element) {
+	entry := elem.Value.(*lruCacheEntry)
+	delete(cache.entries, entry.Key)
+	cache.lru.Remove(elem)
+}
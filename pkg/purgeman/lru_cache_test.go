@@ -0,0 +1,81 @@
+package purgeman
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewLRUCache(2, time.Hour)
+
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+
+	// updates a, makes b the least recently used
+	cache.Put("a", 3)
+	cache.Put("c", 4)
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+
+	if value, ok := cache.Get("a"); !ok || value.(int) != 3 {
+		t.Errorf("expected 3 for a, got %v (%t)", value, ok)
+	}
+
+	if value, ok := cache.Get("c"); !ok || value.(int) != 4 {
+		t.Errorf("expected 4 for c, got %v (%t)", value, ok)
+	}
+}
+
+func TestLRUCacheLenSkipsExpiredEntries(t *testing.T) {
+	cache := NewLRUCache(10, 20*time.Millisecond)
+	cache.Put("a", true)
+
+	time.Sleep(30 * time.Millisecond)
+	cache.Put("b", false)
+
+	// a is expired without being looked up
+	if cache.Len() != 1 {
+		t.Errorf("expected 1 entry, got %d", cache.Len())
+	}
+
+	if value, ok := cache.Get("b"); !ok || value.(bool) {
+		t.Errorf("expected false for b, got %v (%t)", value, ok)
+	}
+}
+
+func TestLRUCacheUpdateAndRemoveIf(t *testing.T) {
+	cache := NewLRUCache(10, time.Hour)
+	cache.Put("a", "/iplant/a")
+	cache.Put("b", "/iplant/b")
+	cache.Put("c", "/tempZone/c")
+
+	cache.Update(func(key string, value interface{}) (interface{}, bool) {
+		if !strings.HasPrefix(value.(string), "/iplant/") {
+			return nil, false
+		}
+		return strings.Replace(value.(string), "/iplant/", "/cyverse/", 1), true
+	})
+
+	if value, _ := cache.Get("a"); value != "/cyverse/a" {
+		t.Errorf("expected a to be updated, got %v", value)
+	}
+
+	if value, _ := cache.Get("c"); value != "/tempZone/c" {
+		t.Errorf("expected c to be kept, got %v", value)
+	}
+
+	cache.RemoveIf(func(key string, value interface{}) bool {
+		return strings.HasPrefix(value.(string), "/cyverse/")
+	})
+
+	if cache.Len() != 1 {
+		t.Errorf("expected 1 entry, got %d", cache.Len())
+	}
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("expected b to be removed")
+	}
+}
@@ -0,0 +1,265 @@
+package purgeman
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// MetricsNamespace is a namespace of prometheus metrics
+	MetricsNamespace string = "purgeman"
+)
+
+const (
+	// reasons of ignored events
+	EventIgnoredUnknownKey  string = "unknown_routing_key"
+	EventIgnoredInvalidBody string = "invalid_body"
+	EventIgnoredFilter      string = "event_filter"
+	EventIgnoredExpired     string = "expired"
+	EventIgnoredPathFilter  string = "path_filter"
+	EventIgnoredNoPolicy    string = "no_policy"
+	EventIgnoredAVUPolicy   string = "avu_policy"
+)
+
+const (
+	// results of UUID resolutions
+	UUIDResolutionHit     string = "hit"
+	UUIDResolutionMiss    string = "miss"
+	UUIDResolutionFailure string = "failure"
+)
+
+const (
+	// components having connections
+	ComponentAMQP  string = "amqp"
+	ComponentIRODS string = "irods"
+)
+
+const (
+	// results of canaries
+	CanaryResultPurged  string = "purged"
+	CanaryResultSkipped string = "skipped"
+	CanaryResultFailure string = "failure"
+)
+
+const (
+	// PurgeStatusClassError is a status class of purge requests failed without a response
+	PurgeStatusClassError string = "error"
+)
+
+// Metrics is a set of prometheus metrics of purgeman
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	EventsReceived  *prometheus.CounterVec
+	EventsAccepted  *prometheus.CounterVec
+	EventsIgnored   *prometheus.CounterVec
+	UUIDResolutions *prometheus.CounterVec
+	Purges          *prometheus.CounterVec
+	PurgeDuration   *prometheus.HistogramVec
+	Connected       *prometheus.GaugeVec
+	Reconnects      *prometheus.CounterVec
+	Canaries        *prometheus.CounterVec
+	CanaryLatency   prometheus.Gauge
+}
+
+// NewMetrics creates a new Metrics
+func NewMetrics() *Metrics {
+	metrics := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		EventsReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "events_received_total",
+			Help:      "Number of messages received from AMQP by routing key",
+		}, []string{"routing_key"}),
+		EventsAccepted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "events_accepted_total",
+			Help:      "Number of events accepted for purging by event type",
+		}, []string{"event_type"}),
+		EventsIgnored: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "events_ignored_total",
+			Help:      "Number of events ignored by reason",
+		}, []string{"reason"}),
+		UUIDResolutions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "uuid_resolutions_total",
+			Help:      "Number of UUID to path resolutions by result (hit, miss, failure)",
+		}, []string{"result"}),
+		Purges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "purges_total",
+			Help:      "Number of purge requests by target and status class (2xx, 4xx, 5xx, error)",
+		}, []string{"target", "status_class"}),
+		PurgeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "purge_duration_seconds",
+			Help:      "Latency of purge requests by target",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+		}, []string{"target"}),
+		Connected: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "connected",
+			Help:      "Connection state by component (amqp, irods), 1 if connected",
+		}, []string{"component"}),
+		Reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "reconnects_total",
+			Help:      "Number of reconnections by component (amqp, irods)",
+		}, []string{"component"}),
+		Canaries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "canaries_total",
+			Help:      "Number of canaries published by result (purged, skipped, failure)",
+		}, []string{"result"}),
+		CanaryLatency: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "canary_latency_seconds",
+			Help:      "End-to-end latency of the last canary purged",
+		}),
+	}
+
+	metrics.Registry.MustRegister(
+		metrics.EventsReceived,
+		metrics.EventsAccepted,
+		metrics.EventsIgnored,
+		metrics.UUIDResolutions,
+		metrics.Purges,
+		metrics.PurgeDuration,
+		metrics.Connected,
+		metrics.Reconnects,
+		metrics.Canaries,
+		metrics.CanaryLatency,
+	)
+
+	metrics.Connected.WithLabelValues(ComponentAMQP).Set(0)
+	metrics.Connected.WithLabelValues(ComponentIRODS).Set(0)
+
+	return metrics
+}
+
+// registerServiceGauges registers gauges reading states of the service
+func (metrics *Metrics) registerServiceGauges(svc *PurgemanService) {
+	metrics.Registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "retry_queue_depth",
+			Help:      "Number of events waiting for retry",
+		}, func() float64 {
+			return float64(svc.RetryQueue.Len())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "pending_events",
+			Help:      "Number of events buffered while iRODS is not available",
+		}, func() float64 {
+			return float64(svc.PendingEvents.Len())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "uuid_cache_entries",
+			Help:      "Number of entries in the UUID cache",
+		}, func() float64 {
+			return float64(svc.UUIDCache.Len())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "event_lag_seconds",
+			Help:      "Lag of the last event received",
+		}, func() float64 {
+			return svc.Lag.LastLag().Seconds()
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "events_dropped_old_total",
+			Help:      "Number of events dropped as they are older than max age of all targets",
+		}, func() float64 {
+			return float64(svc.Lag.Dropped())
+		}),
+	)
+}
+
+// methods below do nothing on nil metrics, so components can be used without metrics
+
+// EventReceived counts a message received
+func (metrics *Metrics) EventReceived(routingKey string) {
+	if metrics == nil {
+		return
+	}
+	metrics.EventsReceived.WithLabelValues(routingKey).Inc()
+}
+
+// EventAccepted counts an event accepted for purging
+func (metrics *Metrics) EventAccepted(eventType string) {
+	if metrics == nil {
+		return
+	}
+	metrics.EventsAccepted.WithLabelValues(eventType).Inc()
+}
+
+// EventIgnored counts an event ignored
+func (metrics *Metrics) EventIgnored(reason string) {
+	if metrics == nil {
+		return
+	}
+	metrics.EventsIgnored.WithLabelValues(reason).Inc()
+}
+
+// UUIDResolved counts a UUID resolution
+func (metrics *Metrics) UUIDResolved(result string) {
+	if metrics == nil {
+		return
+	}
+	metrics.UUIDResolutions.WithLabelValues(result).Inc()
+}
+
+// Reconnected counts a reconnection of the component
+func (metrics *Metrics) Reconnected(component string) {
+	if metrics == nil {
+		return
+	}
+	metrics.Reconnects.WithLabelValues(component).Inc()
+}
+
+// ObserveCanary records a result of a canary, latency is ignored unless it is purged
+func (metrics *Metrics) ObserveCanary(result string, latency time.Duration) {
+	if metrics == nil {
+		return
+	}
+
+	metrics.Canaries.WithLabelValues(result).Inc()
+	if result == CanaryResultPurged {
+		metrics.CanaryLatency.Set(latency.Seconds())
+	}
+}
+
+// ObservePurge records a result of a purge request
+// statusCode is 0 if the request failed without a response
+func (metrics *Metrics) ObservePurge(target string, statusCode int, duration time.Duration) {
+	if metrics == nil {
+		return
+	}
+
+	statusClass := PurgeStatusClassError
+	if statusCode > 0 {
+		statusClass = fmt.Sprintf("%dxx", statusCode/100)
+	}
+
+	metrics.Purges.WithLabelValues(target, statusClass).Inc()
+	metrics.PurgeDuration.WithLabelValues(target).Observe(duration.Seconds())
+}
+
+// SetConnected sets the connection state of the component
+func (metrics *Metrics) SetConnected(component string, connected bool) {
+	if metrics == nil {
+		return
+	}
+
+	value := 0.0
+	if connected {
+		value = 1.0
+	}
+	metrics.Connected.WithLabelValues(component).Set(value)
+}
@@ -0,0 +1,71 @@
+package purgeman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsObservePurge(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.ObservePurge("varnish", 200, 10*time.Millisecond)
+	metrics.ObservePurge("varnish", 204, 10*time.Millisecond)
+	metrics.ObservePurge("varnish", 503, 10*time.Millisecond)
+	metrics.ObservePurge("varnish", 0, time.Second)
+
+	tests := []struct {
+		statusClass string
+		expected    float64
+	}{
+		{"2xx", 2},
+		{"4xx", 0},
+		{"5xx", 1},
+		{PurgeStatusClassError, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.statusClass, func(t *testing.T) {
+			count := testutil.ToFloat64(metrics.Purges.WithLabelValues("varnish", test.statusClass))
+			if count != test.expected {
+				t.Errorf("expected %v purges, got %v", test.expected, count)
+			}
+		})
+	}
+
+	if count := testutil.CollectAndCount(metrics.PurgeDuration); count != 1 {
+		t.Errorf("expected a latency histogram for the target, got %d", count)
+	}
+}
+
+func TestMetricsSetConnected(t *testing.T) {
+	metrics := NewMetrics()
+
+	if connected := testutil.ToFloat64(metrics.Connected.WithLabelValues(ComponentAMQP)); connected != 0 {
+		t.Errorf("expected AMQP to be disconnected initially, got %v", connected)
+	}
+
+	metrics.SetConnected(ComponentAMQP, true)
+	metrics.Reconnected(ComponentAMQP)
+
+	if connected := testutil.ToFloat64(metrics.Connected.WithLabelValues(ComponentAMQP)); connected != 1 {
+		t.Errorf("expected AMQP to be connected, got %v", connected)
+	}
+
+	if reconnects := testutil.ToFloat64(metrics.Reconnects.WithLabelValues(ComponentAMQP)); reconnects != 1 {
+		t.Errorf("expected a reconnect, got %v", reconnects)
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	// components can be used without metrics
+	var metrics *Metrics
+
+	metrics.EventReceived("data-object.add")
+	metrics.EventAccepted("data-object.add")
+	metrics.EventIgnored(EventIgnoredFilter)
+	metrics.UUIDResolved(UUIDResolutionHit)
+	metrics.Reconnected(ComponentIRODS)
+	metrics.ObservePurge("varnish", 200, time.Millisecond)
+	metrics.SetConnected(ComponentIRODS, true)
+}
@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/rs/xid"
 	log "github.com/sirupsen/logrus"
@@ -20,6 +23,11 @@ type IRODSMessageQueueConfig struct {
 	VHost    string
 	Exchange string // can be empty
 	Queue    string // can be empty
+	// QueueExpiry is how long the queue declared is kept without consumers, 0 to delete it when consumers are gone
+	QueueExpiry time.Duration
+
+	TimestampField string // a field of message body having the time of the event, can be empty
+	DryRun         bool   // names the queue declared differently from the one of the service
 }
 
 // IRODSMessageQueueConnection is a connection object for iRODS message queue
@@ -28,10 +36,33 @@ type IRODSMessageQueueConnection struct {
 	AMQPConnection *amqp.Connection
 	AMQPChannel    *amqp.Channel
 	StartMonitor   bool
+	Metrics        *Metrics       // can be nil
+	Health         *HealthTracker // can be nil
+	Pause          *PauseSwitch   // can be nil
+	Capture        *CaptureWriter // records raw deliveries if not nil
+
+	consumerTag string
+	closed      chan struct{}
+	closeOnce   sync.Once
+}
+
+// FSEvent is a file system event received from iRODS message queue
+type FSEvent struct {
+	EventType string `json:"event_type"`
+	Path      string `json:"path,omitempty"`     // new path for mv events, empty if the message does not have path
+	OldPath   string `json:"old_path,omitempty"` // old path for mv events
+	UUID      string `json:"uuid,omitempty"`
+	Attempts  int    `json:"attempts,omitempty"` // number of failed attempts to resolve the path
+
+	Timestamp time.Time `json:"timestamp,omitempty"` // time of the event, zero if unknown
+	Replayed  bool      `json:"-"`                   // true if the event is replayed from the pending buffer
+	Manual    bool      `json:"-"`                   // true if the event is given via the admin API or the command line
+
+	Body map[string]interface{} `json:"body,omitempty"` // raw message body
 }
 
 // FSEventHandler is a handler for file system events
-type FSEventHandler func(eventtype string, path string, uuid string)
+type FSEventHandler func(event *FSEvent)
 
 func makeAMQPURL(config *IRODSMessageQueueConfig) string {
 	return fmt.Sprintf("amqp://%s:%s@%s:%d/%s", config.Username, config.Password, config.Host, config.Port, config.VHost)
@@ -63,6 +94,8 @@ func ConnectIRODSMessageQueue(config *IRODSMessageQueueConfig) (*IRODSMessageQue
 		AMQPConnection: messageQueueConn,
 		AMQPChannel:    messageQueueChan,
 		StartMonitor:   true,
+		consumerTag:    fmt.Sprintf("purgeman.%s", xid.New().String()),
+		closed:         make(chan struct{}),
 	}, nil
 }
 
@@ -74,32 +107,36 @@ func (conn *IRODSMessageQueueConnection) MonitorFSChanges(handler FSEventHandler
 		"function": "MonitorFSChanges",
 	})
 
-	if len(conn.Config.Queue) == 0 && len(conn.Config.Exchange) > 0 {
-		// create a queue
-		quename := conn.getQueueName()
-		logger.Infof("Declaring a queue %s", quename)
+	// a queue declared is declared again on resume, an auto-delete queue is deleted when the consumer is cancelled
+	declare := len(conn.Config.Queue) == 0
+	if declare && len(conn.Config.Exchange) == 0 {
+		return fmt.Errorf("no queue or exchange given")
+	}
 
-		queue, err := conn.AMQPChannel.QueueDeclare(quename, false, true, false, false, amqp.Table{})
-		if err != nil {
-			logger.WithError(err).Errorf("Could not declare a queue")
-			return err
-		}
+	for conn.StartMonitor {
+		if conn.Pause.IsPaused() {
+			logger.Info("Consumption is paused")
+			conn.Health.Set(ComponentAMQP, false, "paused")
 
-		err = conn.AMQPChannel.QueueBind(queue.Name, "#", conn.Config.Exchange, false, amqp.Table{})
-		if err != nil {
-			logger.WithError(err).Errorf("Could not bind the queue")
-			return err
+			if !conn.Pause.Wait(conn.closed) {
+				// disconnected
+				return nil
+			}
+
+			logger.Info("Consumption is resumed")
+			continue
 		}
 
-		conn.Config.Queue = queue.Name
-	} else if len(conn.Config.Queue) == 0 && len(conn.Config.Exchange) == 0 {
-		return fmt.Errorf("no queue or exchange given")
-	}
+		if declare {
+			err := conn.declareQueue()
+			if err != nil {
+				return err
+			}
+		}
 
-	for conn.StartMonitor {
 		msgs, err := conn.AMQPChannel.Consume(
 			conn.Config.Queue, // queue
-			"",                // consumer
+			conn.consumerTag,  // consumer
 			true,              // autoAck
 			false,             // exclusive
 			false,             // noLocal
@@ -112,20 +149,86 @@ func (conn *IRODSMessageQueueConnection) MonitorFSChanges(handler FSEventHandler
 			return err
 		}
 
+		if conn.Pause.IsPaused() {
+			// paused while registering the consumer
+			conn.CancelConsumer()
+		} else {
+			conn.Health.Set(ComponentAMQP, true, fmt.Sprintf("consuming queue %s", conn.Config.Queue))
+		}
+
 		for msg := range msgs {
+			conn.Metrics.EventReceived(msg.RoutingKey)
+
+			if conn.Capture != nil {
+				err := conn.Capture.Write(msg)
+				if err != nil {
+					logger.WithError(err).Error("Failed to capture a delivery")
+				}
+			}
+
 			// filter file system events
-			if conn.acceptFSEvents(msg) {
-				go conn.handleFSEvents(msg, handler)
+			if acceptFSEvents(msg, conn.Metrics) {
+				go handleFSEvents(msg, conn.Config.TimestampField, conn.Metrics, handler)
 			}
 		}
 	}
 	return nil
 }
 
-// Destroy destroys the purgeman service
+// declareQueue declares a queue for the host and binds it to the exchange
+func (conn *IRODSMessageQueueConnection) declareQueue() error {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "IRODSMessageQueueConnection",
+		"function": "declareQueue",
+	})
+
+	quename := conn.getQueueName()
+	logger.Infof("Declaring a queue %s", quename)
+
+	// instances on the same host share the queue, it is kept for the expiry without consumers if given
+	autoDelete := true
+	args := amqp.Table{}
+	if conn.Config.QueueExpiry > 0 {
+		autoDelete = false
+		args["x-expires"] = int64(conn.Config.QueueExpiry / time.Millisecond)
+	}
+
+	queue, err := conn.AMQPChannel.QueueDeclare(quename, false, autoDelete, false, false, args)
+	if err != nil {
+		logger.WithError(err).Errorf("Could not declare a queue")
+		return err
+	}
+
+	err = conn.AMQPChannel.QueueBind(queue.Name, "#", conn.Config.Exchange, false, amqp.Table{})
+	if err != nil {
+		logger.WithError(err).Errorf("Could not bind the queue")
+		return err
+	}
+
+	conn.Config.Queue = queue.Name
+	return nil
+}
+
+// CancelConsumer stops receiving messages, MonitorFSChanges waits until the pause switch is resumed
+func (conn *IRODSMessageQueueConnection) CancelConsumer() error {
+	if conn.AMQPChannel == nil {
+		return fmt.Errorf("channel is closed")
+	}
+
+	return conn.AMQPChannel.Cancel(conn.consumerTag, false)
+}
+
+// Disconnect closes the connection
 func (conn *IRODSMessageQueueConnection) Disconnect() {
 	conn.StartMonitor = false
 
+	if conn.closed != nil {
+		conn.closeOnce.Do(func() {
+			close(conn.closed)
+		})
+	}
+
 	if conn.AMQPChannel != nil {
 		conn.AMQPChannel.Close()
 		conn.AMQPChannel = nil
@@ -140,14 +243,25 @@ func (conn *IRODSMessageQueueConnection) Disconnect() {
 	}
 }
 
-func (conn *IRODSMessageQueueConnection) acceptFSEvents(msg amqp.Delivery) bool {
+// acceptFSEvents checks if the delivery is a file system event that purgeman handles
+func acceptFSEvents(msg amqp.Delivery, metrics *Metrics) bool {
 	logger := log.WithFields(log.Fields{
 		"package":  "purgeman",
-		"struct":   "IRODSMessageQueueConnection",
-		"function": "handleFSEvents",
+		"function": "acceptFSEvents",
 	})
 
-	switch msg.RoutingKey {
+	if IsFSEventType(msg.RoutingKey) {
+		return true
+	}
+
+	logger.Infof("ignoring unknown message key - %s", msg.RoutingKey)
+	metrics.EventIgnored(EventIgnoredUnknownKey)
+	return false
+}
+
+// IsFSEventType checks if the event type is a file system event that purgeman handles
+func IsFSEventType(eventType string) bool {
+	switch eventType {
 	case "data-object.add", "data-object.mod", "data-object.mv", "data-object.rm":
 		return true
 	case "data-object.sys-metadata.mod":
@@ -155,20 +269,21 @@ func (conn *IRODSMessageQueueConnection) acceptFSEvents(msg amqp.Delivery) bool
 	case "collection.add", "collection.mv", "collection.rm":
 		return true
 	default:
-		logger.Infof("ignoring unknown message key - %s", msg.RoutingKey)
 		return false
 	}
 }
 
-func (conn *IRODSMessageQueueConnection) handleFSEvents(msg amqp.Delivery, handler FSEventHandler) {
+// handleFSEvents converts the delivery to a file system event and calls the handler
+// timestampField is a field of message body having the time of the event, can be empty
+func handleFSEvents(msg amqp.Delivery, timestampField string, metrics *Metrics, handler FSEventHandler) {
 	logger := log.WithFields(log.Fields{
 		"package":  "purgeman",
-		"struct":   "IRODSMessageQueueConnection",
 		"function": "handleFSEvents",
 	})
 
 	if strings.Contains(string(msg.Body), "\r") {
-		logger.Error("Body with return in it: %s\n", string(msg.Body))
+		logger.Errorf("Body with return in it: %s", string(msg.Body))
+		metrics.EventIgnored(EventIgnoredInvalidBody)
 		return
 	}
 
@@ -176,33 +291,131 @@ func (conn *IRODSMessageQueueConnection) handleFSEvents(msg amqp.Delivery, handl
 	err := json.Unmarshal(msg.Body, &body)
 	if err != nil {
 		logger.WithError(err).Errorf("Failed to parse message body - %s : %v", msg.RoutingKey, string(msg.Body))
+		metrics.EventIgnored(EventIgnoredInvalidBody)
 		return
 	}
 
+	// use the delivery timestamp if the body does not have the time of the event
+	timestamp, ok := getBodyTime(body, timestampField)
+	if !ok {
+		timestamp = msg.Timestamp
+	}
+
 	switch msg.RoutingKey {
-	case "data-object.add", "data-object.rm":
-		handler(msg.RoutingKey, body["path"].(string), body["entity"].(string))
-	case "data-object.mv":
-		handler(msg.RoutingKey, body["old-path"].(string), body["entity"].(string))
-		handler(msg.RoutingKey, body["new-path"].(string), body["entity"].(string))
-	case "collection.add", "collection.rm":
-		handler(msg.RoutingKey, body["path"].(string), body["entity"].(string))
-	case "collection.mv":
-		handler(msg.RoutingKey, body["old-path"].(string), body["entity"].(string))
-		handler(msg.RoutingKey, body["new-path"].(string), body["entity"].(string))
+	case "data-object.add", "data-object.rm", "collection.add", "collection.rm":
+		handler(&FSEvent{
+			EventType: msg.RoutingKey,
+			Path:      getBodyString(body, "path"),
+			UUID:      getBodyString(body, "entity"),
+			Timestamp: timestamp,
+			Body:      body,
+		})
+	case "data-object.mv", "collection.mv":
+		handler(&FSEvent{
+			EventType: msg.RoutingKey,
+			Path:      getBodyString(body, "new-path"),
+			OldPath:   getBodyString(body, "old-path"),
+			UUID:      getBodyString(body, "entity"),
+			Timestamp: timestamp,
+			Body:      body,
+		})
 	case "data-object.mod", "data-object.sys-metadata.mod":
 		// does not have path
-		handler(msg.RoutingKey, "", body["entity"].(string))
+		handler(&FSEvent{
+			EventType: msg.RoutingKey,
+			UUID:      getBodyString(body, "entity"),
+			Timestamp: timestamp,
+			Body:      body,
+		})
 	default:
 		return
 	}
 }
 
+// getBodyTime returns a time field of the message body, returns false if the field does not exist or is not a time
+// RFC3339 strings and unix times in seconds or milliseconds are accepted
+func getBodyTime(body map[string]interface{}, field string) (time.Time, bool) {
+	value, ok := getBodyValueString(body, field)
+	if !ok || len(value) == 0 {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err == nil {
+		return t, true
+	}
+
+	epoch, err := strconv.ParseFloat(value, 64)
+	if err != nil || epoch <= 0 {
+		return time.Time{}, false
+	}
+
+	if epoch > 1e12 {
+		// milliseconds
+		return time.Unix(0, int64(epoch*float64(time.Millisecond))), true
+	}
+	return time.Unix(0, int64(epoch*float64(time.Second))), true
+}
+
+// getBodyString returns a string field of the message body, returns empty if the field does not exist
+// numbers are converted to strings
+func getBodyString(body map[string]interface{}, field string) string {
+	value, _ := getBodyValueString(body, field)
+	return value
+}
+
+// getBodyValueString returns a string field of the message body, returns false if the field does not exist
+// nested fields can be given with dots, e.g., author.name
+func getBodyValueString(body map[string]interface{}, field string) (string, bool) {
+	if len(field) == 0 {
+		return "", false
+	}
+
+	value, ok := body[field]
+	if !ok && strings.Contains(field, ".") {
+		// nested field
+		names := strings.Split(field, ".")
+		current := body
+		for idx, name := range names {
+			value, ok = current[name]
+			if !ok {
+				return "", false
+			}
+
+			if idx < len(names)-1 {
+				current, ok = value.(map[string]interface{})
+				if !ok {
+					return "", false
+				}
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		return "", false
+	}
+}
+
 func (conn *IRODSMessageQueueConnection) getQueueName() string {
+	return getDeclaredQueueName(conn.Config.DryRun)
+}
+
+// getDeclaredQueueName returns a name of the queue declared for the host
+func getDeclaredQueueName(dryRun bool) string {
 	hostname, err := os.Hostname()
 	if err != nil {
 		hostname = fmt.Sprintf("autocreated.%s", xid.New().String())
 	}
 
+	if dryRun {
+		return fmt.Sprintf("purgeman.dryrun.%s", hostname)
+	}
 	return fmt.Sprintf("purgeman.%s", hostname)
 }
@@ -0,0 +1,81 @@
+package purgeman
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestGetBodyTime(t *testing.T) {
+	expected := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		body     string
+		field    string
+		expected time.Time
+		ok       bool
+	}{
+		{"RFC3339", `{"timestamp": "2021-01-01T00:00:00Z"}`, "timestamp", expected, true},
+		{"RFC3339 with fraction and zone", `{"timestamp": "2021-01-01T09:00:00.5+09:00"}`, "timestamp", expected.Add(500 * time.Millisecond), true},
+		{"unix seconds", `{"timestamp": 1609459200}`, "timestamp", expected, true},
+		{"unix seconds with fraction", `{"timestamp": "1609459200.25"}`, "timestamp", expected.Add(250 * time.Millisecond), true},
+		{"unix milliseconds", `{"timestamp": 1609459200123}`, "timestamp", expected.Add(123 * time.Millisecond), true},
+		{"nested field", `{"event": {"time": "2021-01-01T00:00:00Z"}}`, "event.time", expected, true},
+		{"missing field", `{"path": "/iplant/a"}`, "timestamp", time.Time{}, false},
+		{"no field given", `{"timestamp": "2021-01-01T00:00:00Z"}`, "", time.Time{}, false},
+		{"not a time", `{"timestamp": "yesterday"}`, "timestamp", time.Time{}, false},
+		{"negative", `{"timestamp": -1}`, "timestamp", time.Time{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := map[string]interface{}{}
+			err := json.Unmarshal([]byte(test.body), &body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			bodyTime, ok := getBodyTime(body, test.field)
+			if ok != test.ok {
+				t.Fatalf("expected ok %t, got %t", test.ok, ok)
+			}
+
+			// float conversions may lose sub-microsecond precision
+			if ok && bodyTime.Sub(test.expected).Round(time.Microsecond) != 0 {
+				t.Errorf("expected %s, got %s", test.expected, bodyTime)
+			}
+		})
+	}
+}
+
+func TestGetBodyString(t *testing.T) {
+	body := map[string]interface{}{
+		"path":    "/iplant/home/user/a.txt",
+		"data_id": float64(10001),
+		"size":    1.5,
+		"author":  map[string]interface{}{"name": "user"},
+	}
+
+	tests := []struct {
+		name     string
+		field    string
+		expected string
+	}{
+		{"string", "path", "/iplant/home/user/a.txt"},
+		{"integer", "data_id", "10001"},
+		{"fraction", "size", "1.5"},
+		{"object", "author", ""},
+		{"missing", "entity", ""},
+		{"no field", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value := getBodyString(body, test.field)
+			if value != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package purgeman
+
+import (
+	"regexp"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+)
+
+// PathFilter filters iRODS paths with include and exclude patterns
+type PathFilter struct {
+	includes []*regexp.Regexp
+	excludes []*regexp.Regexp
+}
+
+// NewPathFilter creates a new PathFilter
+func NewPathFilter(includes []string, excludes []string) (*PathFilter, error) {
+	filter := &PathFilter{}
+
+	for _, pattern := range includes {
+		regex, err := commons.CompilePathPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		filter.includes = append(filter.includes, regex)
+	}
+
+	for _, pattern := range excludes {
+		regex, err := commons.CompilePathPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		filter.excludes = append(filter.excludes, regex)
+	}
+
+	return filter, nil
+}
+
+// Accepts checks if the path matches any of include patterns (if given) and none of exclude patterns
+func (filter *PathFilter) Accepts(path string) bool {
+	if len(filter.includes) > 0 {
+		included := false
+		for _, regex := range filter.includes {
+			if regex.MatchString(path) {
+				included = true
+				break
+			}
+		}
+
+		if !included {
+			return false
+		}
+	}
+
+	for _, regex := range filter.excludes {
+		if regex.MatchString(path) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,75 @@
+package purgeman
+
+import (
+	"sync"
+)
+
+// PauseSwitch pauses and resumes consumption of events
+type PauseSwitch struct {
+	paused     bool
+	resumeChan chan struct{}
+	mutex      sync.Mutex
+}
+
+// NewPauseSwitch creates a new PauseSwitch
+func NewPauseSwitch() *PauseSwitch {
+	return &PauseSwitch{}
+}
+
+// Pause pauses, returns false if already paused
+func (sw *PauseSwitch) Pause() bool {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+
+	if sw.paused {
+		return false
+	}
+
+	sw.paused = true
+	sw.resumeChan = make(chan struct{})
+	return true
+}
+
+// Resume resumes, returns false if not paused
+func (sw *PauseSwitch) Resume() bool {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+
+	if !sw.paused {
+		return false
+	}
+
+	sw.paused = false
+	close(sw.resumeChan)
+	return true
+}
+
+// IsPaused returns true if paused
+func (sw *PauseSwitch) IsPaused() bool {
+	if sw == nil {
+		return false
+	}
+
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+
+	return sw.paused
+}
+
+// Wait waits until resumed, returns false if done is closed while waiting
+func (sw *PauseSwitch) Wait(done <-chan struct{}) bool {
+	sw.mutex.Lock()
+	if !sw.paused {
+		sw.mutex.Unlock()
+		return true
+	}
+	resumeChan := sw.resumeChan
+	sw.mutex.Unlock()
+
+	select {
+	case <-resumeChan:
+		return true
+	case <-done:
+		return false
+	}
+}
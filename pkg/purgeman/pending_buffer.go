@@ -0,0 +1,314 @@
+package purgeman
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PendingEventBuffer buffers events while they cannot be handled
+// events are kept in memory up to MaxSize, and spilled to a file when the memory buffer is full
+type PendingEventBuffer struct {
+	MaxSize      int
+	SpillPath    string // can be empty to disable spill
+	SpillMaxSize int
+
+	events  []*FSEvent
+	spilled int
+	mutex   sync.Mutex
+}
+
+// NewPendingEventBuffer creates a new PendingEventBuffer
+// files at spillPath are not touched until the buffer is used or recovered, as they may be owned by another service
+func NewPendingEventBuffer(maxSize int, spillPath string, spillMaxSize int) *PendingEventBuffer {
+	return &PendingEventBuffer{
+		MaxSize:      maxSize,
+		SpillPath:    spillPath,
+		SpillMaxSize: spillMaxSize,
+		events:       []*FSEvent{},
+	}
+}
+
+// Recover counts events spilled by previous runs, so they are replayed later
+// events left in the replay file by a run terminated while replaying are recovered too
+// it must be called only by the service owning the spill file
+func (buffer *PendingEventBuffer) Recover() error {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PendingEventBuffer",
+		"function": "Recover",
+	})
+
+	if len(buffer.SpillPath) == 0 {
+		return nil
+	}
+
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	err := buffer.recoverReplayFile()
+	if err != nil {
+		return fmt.Errorf("failed to recover the replay file %s - %v", buffer.getReplayPath(), err)
+	}
+
+	spilled, err := countLines(buffer.SpillPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read the spill file %s - %v", buffer.SpillPath, err)
+	}
+
+	if spilled > 0 {
+		logger.Infof("Found %d spilled events in %s", spilled, buffer.SpillPath)
+	}
+	buffer.spilled = spilled
+	return nil
+}
+
+// Push adds an event to the buffer, returns error if the buffer is full
+func (buffer *PendingEventBuffer) Push(event *FSEvent) error {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	if len(buffer.events) < buffer.MaxSize {
+		buffer.events = append(buffer.events, event)
+		return nil
+	}
+
+	if len(buffer.SpillPath) == 0 {
+		return fmt.Errorf("pending event buffer is full")
+	}
+
+	if buffer.SpillMaxSize > 0 && buffer.spilled >= buffer.SpillMaxSize {
+		return fmt.Errorf("pending event spill file %s is full", buffer.SpillPath)
+	}
+
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(buffer.SpillPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(eventBytes, '\n'))
+	if err != nil {
+		return err
+	}
+
+	buffer.spilled++
+	return nil
+}
+
+// Len returns the number of buffered events including spilled events
+func (buffer *PendingEventBuffer) Len() int {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	return len(buffer.events) + buffer.spilled
+}
+
+// Flush drops all buffered events including spilled events, returns the number of dropped events
+func (buffer *PendingEventBuffer) Flush() (int, error) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	count := len(buffer.events) + buffer.spilled
+	buffer.events = []*FSEvent{}
+
+	if buffer.spilled > 0 {
+		buffer.spilled = 0
+		err := os.Remove(buffer.SpillPath)
+		if err != nil && !os.IsNotExist(err) {
+			return count, err
+		}
+	}
+
+	if len(buffer.SpillPath) > 0 {
+		// left by a failed drain
+		err := os.Remove(buffer.getReplayPath())
+		if err != nil && !os.IsNotExist(err) {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// Drain removes all buffered events and calls the handler for each of them in order
+// events in memory are older than spilled events
+// the replay file is removed only when all spilled events are replayed, otherwise it is recovered later
+// and events already replayed are handled again, which is harmless as purges are idempotent
+func (buffer *PendingEventBuffer) Drain(handler FSEventHandler) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PendingEventBuffer",
+		"function": "Drain",
+	})
+
+	buffer.mutex.Lock()
+	events := buffer.events
+	buffer.events = []*FSEvent{}
+
+	replayPath := ""
+	if len(buffer.SpillPath) > 0 {
+		// a replay file left by a failed drain must not be overwritten
+		err := buffer.recoverReplayFile()
+		if err != nil {
+			buffer.mutex.Unlock()
+			return err
+		}
+
+		spilled, err := countLines(buffer.SpillPath)
+		if err != nil && !os.IsNotExist(err) {
+			buffer.mutex.Unlock()
+			return err
+		}
+		buffer.spilled = spilled
+	}
+
+	if buffer.spilled > 0 {
+		// move the spill file away, so new events can be spilled while replaying
+		replayPath = buffer.getReplayPath()
+		err := os.Rename(buffer.SpillPath, replayPath)
+		if err != nil {
+			buffer.mutex.Unlock()
+			return err
+		}
+
+		buffer.spilled = 0
+	}
+	buffer.mutex.Unlock()
+
+	for _, event := range events {
+		handler(event)
+	}
+
+	if len(replayPath) == 0 {
+		return nil
+	}
+
+	file, err := os.Open(replayPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	lineNum := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		lineNum++
+
+		event := FSEvent{}
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			logger.WithError(err).Warnf("Skipping an invalid spilled event at line %d of %s", lineNum, replayPath)
+			continue
+		}
+
+		handler(&event)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return fmt.Errorf("failed to read spilled events in %s - %v", replayPath, err)
+	}
+
+	file.Close()
+	return os.Remove(replayPath)
+}
+
+func (buffer *PendingEventBuffer) getReplayPath() string {
+	return buffer.SpillPath + ".replay"
+}
+
+// recoverReplayFile puts events in a replay file left behind back to the spill file
+// they are older than spilled events, so they go first. the caller must hold buffer.mutex, or own the buffer
+func (buffer *PendingEventBuffer) recoverReplayFile() error {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PendingEventBuffer",
+		"function": "recoverReplayFile",
+	})
+
+	replayPath := buffer.getReplayPath()
+	_, err := os.Stat(replayPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	logger.Infof("Recovering spilled events left in %s", replayPath)
+
+	_, err = os.Stat(buffer.SpillPath)
+	if os.IsNotExist(err) {
+		return os.Rename(replayPath, buffer.SpillPath)
+	}
+
+	recoverPath := buffer.SpillPath + ".recover"
+	err = concatFiles(recoverPath, replayPath, buffer.SpillPath)
+	if err != nil {
+		os.Remove(recoverPath)
+		return err
+	}
+
+	err = os.Rename(recoverPath, buffer.SpillPath)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(replayPath)
+}
+
+// concatFiles writes contents of the source files to the destination file in order
+func concatFiles(destPath string, sourcePaths ...string) error {
+	dest, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	for _, sourcePath := range sourcePaths {
+		source, err := os.Open(sourcePath)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(dest, source)
+		source.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return dest.Close()
+}
+
+func countLines(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		count++
+	}
+
+	return count, scanner.Err()
+}
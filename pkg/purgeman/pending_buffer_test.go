@@ -0,0 +1,178 @@
+package purgeman
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTestSpillPath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "purgeman-pending")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	return filepath.Join(dir, "pending.jsonl")
+}
+
+func drainPaths(t *testing.T, buffer *PendingEventBuffer) []string {
+	paths := []string{}
+	err := buffer.Drain(func(event *FSEvent) {
+		paths = append(paths, event.Path)
+	})
+	if err != nil {
+		t.Fatalf("failed to drain - %v", err)
+	}
+	return paths
+}
+
+func TestPendingEventBufferSpillsAndDrainsInOrder(t *testing.T) {
+	spillPath := newTestSpillPath(t)
+	buffer := NewPendingEventBuffer(2, spillPath, 0)
+
+	for _, path := range []string{"/a", "/b", "/c", "/d"} {
+		err := buffer.Push(&FSEvent{Path: path})
+		if err != nil {
+			t.Fatalf("failed to push %s - %v", path, err)
+		}
+	}
+
+	if buffer.Len() != 4 {
+		t.Errorf("expected 4 events, got %d", buffer.Len())
+	}
+
+	paths := drainPaths(t, buffer)
+	if !reflect.DeepEqual(paths, []string{"/a", "/b", "/c", "/d"}) {
+		t.Errorf("unexpected order %v", paths)
+	}
+
+	if buffer.Len() != 0 {
+		t.Errorf("expected an empty buffer, got %d", buffer.Len())
+	}
+
+	if _, err := os.Stat(spillPath + ".replay"); !os.IsNotExist(err) {
+		t.Errorf("expected the replay file to be removed")
+	}
+}
+
+func TestPendingEventBufferLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		spillPath bool
+		spillMax  int
+		pushes    int
+		accepted  int
+	}{
+		{"memory only", false, 0, 3, 2},
+		{"spill unlimited", true, 0, 5, 5},
+		{"spill limited", true, 2, 5, 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spillPath := ""
+			if test.spillPath {
+				spillPath = newTestSpillPath(t)
+			}
+
+			buffer := NewPendingEventBuffer(2, spillPath, test.spillMax)
+
+			accepted := 0
+			for idx := 0; idx < test.pushes; idx++ {
+				if buffer.Push(&FSEvent{Path: "/a"}) == nil {
+					accepted++
+				}
+			}
+
+			if accepted != test.accepted {
+				t.Errorf("expected %d accepted events, got %d", test.accepted, accepted)
+			}
+		})
+	}
+}
+
+func TestPendingEventBufferSkipsInvalidSpilledEvents(t *testing.T) {
+	spillPath := newTestSpillPath(t)
+	err := ioutil.WriteFile(spillPath, []byte("{\"path\":\"/a\"}\nnot json\n{\"path\":\"/b\"}\n"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := NewPendingEventBuffer(10, spillPath, 0)
+	err = buffer.Recover()
+	if err != nil {
+		t.Fatalf("failed to recover - %v", err)
+	}
+
+	if buffer.Len() != 3 {
+		t.Errorf("expected 3 spilled lines, got %d", buffer.Len())
+	}
+
+	paths := drainPaths(t, buffer)
+	if !reflect.DeepEqual(paths, []string{"/a", "/b"}) {
+		t.Errorf("unexpected events %v", paths)
+	}
+}
+
+func TestPendingEventBufferRecoversReplayFile(t *testing.T) {
+	spillPath := newTestSpillPath(t)
+
+	// a replay file left by a process terminated while replaying, and events spilled after it
+	err := ioutil.WriteFile(spillPath+".replay", []byte("{\"path\":\"/old\"}\n"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(spillPath, []byte("{\"path\":\"/new\"}\n"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := NewPendingEventBuffer(10, spillPath, 0)
+
+	// the files may be owned by another service until recovered
+	_, err = os.Stat(spillPath + ".replay")
+	if err != nil {
+		t.Errorf("expected the replay file to be kept until recovered - %v", err)
+	}
+
+	err = buffer.Recover()
+	if err != nil {
+		t.Fatalf("failed to recover - %v", err)
+	}
+
+	if buffer.Len() != 2 {
+		t.Errorf("expected 2 recovered events, got %d", buffer.Len())
+	}
+
+	paths := drainPaths(t, buffer)
+	if !reflect.DeepEqual(paths, []string{"/old", "/new"}) {
+		t.Errorf("unexpected order %v", paths)
+	}
+}
+
+func TestPendingEventBufferFlush(t *testing.T) {
+	spillPath := newTestSpillPath(t)
+	buffer := NewPendingEventBuffer(1, spillPath, 0)
+
+	buffer.Push(&FSEvent{Path: "/a"})
+	buffer.Push(&FSEvent{Path: "/b"})
+
+	flushed, err := buffer.Flush()
+	if err != nil {
+		t.Fatalf("failed to flush - %v", err)
+	}
+
+	if flushed != 2 {
+		t.Errorf("expected 2 flushed events, got %d", flushed)
+	}
+
+	if paths := drainPaths(t, buffer); len(paths) != 0 {
+		t.Errorf("expected no events after flush, got %v", paths)
+	}
+}
@@ -0,0 +1,203 @@
+package purgeman
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+)
+
+// PurgeAction is a parsed purge action of a policy rule
+type PurgeAction struct {
+	Type     string
+	Levels   int
+	Template string
+}
+
+// PurgePath is a path to purge
+type PurgePath struct {
+	Path    string
+	Subtree bool
+	// UUID is given only if the path is the path of the event
+	UUID string
+	// EventTime is the time of the event, zero if unknown
+	EventTime time.Time
+	// EventType is the type of the event, empty if unknown
+	EventType string
+}
+
+// purgePolicyRule is a compiled policy rule
+type purgePolicyRule struct {
+	Events    []string
+	PathRegex *regexp.Regexp
+	Actions   []PurgeAction
+}
+
+// PurgePolicy decides what to purge for events
+type PurgePolicy struct {
+	rules []*purgePolicyRule
+}
+
+// NewPurgePolicy creates a new PurgePolicy
+func NewPurgePolicy(rules []commons.PolicyRule) (*PurgePolicy, error) {
+	policy := &PurgePolicy{}
+
+	for idx := range rules {
+		rule := &rules[idx]
+
+		err := rule.Validate()
+		if err != nil {
+			return nil, err
+		}
+
+		compiledRule := &purgePolicyRule{
+			Events: rule.Events,
+		}
+
+		if len(rule.Path) > 0 {
+			regex, err := commons.CompilePathPattern(rule.Path)
+			if err != nil {
+				return nil, err
+			}
+			compiledRule.PathRegex = regex
+		}
+
+		for _, action := range rule.Actions {
+			actionType, arg, err := commons.ParsePurgeAction(action)
+			if err != nil {
+				return nil, err
+			}
+
+			purgeAction := PurgeAction{
+				Type: actionType,
+			}
+
+			switch actionType {
+			case commons.PurgeActionAncestors:
+				purgeAction.Levels, _ = strconv.Atoi(arg)
+			case commons.PurgeActionTemplate:
+				purgeAction.Template = arg
+			}
+
+			compiledRule.Actions = append(compiledRule.Actions, purgeAction)
+		}
+
+		policy.rules = append(policy.rules, compiledRule)
+	}
+
+	return policy, nil
+}
+
+// Match returns actions of the first rule matching the event type and the path
+// returns false if no rules match
+func (policy *PurgePolicy) Match(eventType string, irodsPath string) ([]PurgeAction, bool) {
+	for _, rule := range policy.rules {
+		if rule.matches(eventType, irodsPath) {
+			return rule.Actions, true
+		}
+	}
+
+	return nil, false
+}
+
+func (rule *purgePolicyRule) matches(eventType string, irodsPath string) bool {
+	if rule.PathRegex != nil && !rule.PathRegex.MatchString(irodsPath) {
+		return false
+	}
+
+	if len(rule.Events) == 0 {
+		return true
+	}
+
+	for _, event := range rule.Events {
+		matched, err := path.Match(event, eventType)
+		if err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ExpandPurgeActions returns paths to purge for the iRODS path, duplicates are removed
+func ExpandPurgeActions(actions []PurgeAction, irodsPath string, uuid string) []PurgePath {
+	purgePaths := []PurgePath{}
+	seen := map[PurgePath]bool{}
+
+	add := func(p string, subtree bool) {
+		if len(p) == 0 {
+			return
+		}
+
+		purgePath := PurgePath{
+			Path:    p,
+			Subtree: subtree,
+		}
+
+		if p == irodsPath {
+			purgePath.UUID = uuid
+		}
+
+		if !seen[purgePath] {
+			seen[purgePath] = true
+			purgePaths = append(purgePaths, purgePath)
+		}
+	}
+
+	for _, action := range actions {
+		switch action.Type {
+		case commons.PurgeActionSelf:
+			add(irodsPath, false)
+		case commons.PurgeActionParent:
+			if irodsPath != "/" {
+				add(path.Dir(irodsPath), false)
+			}
+		case commons.PurgeActionAncestors:
+			ancestor := irodsPath
+			for level := 0; level < action.Levels && ancestor != "/"; level++ {
+				ancestor = path.Dir(ancestor)
+				add(ancestor, false)
+			}
+		case commons.PurgeActionSubtree:
+			add(irodsPath, true)
+		case commons.PurgeActionTemplate:
+			templatePath, ok := expandPathTemplate(action.Template, irodsPath, uuid)
+			if ok {
+				add(path.Clean(templatePath), false)
+			}
+		}
+	}
+
+	return purgePaths
+}
+
+// getAVUPolicyActions returns actions for a purge policy given in an AVU
+// "ancestors" without levels purges all ancestors of the path
+func getAVUPolicyActions(policy string, irodsPath string) ([]PurgeAction, error) {
+	err := commons.ValidateAVUPolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	switch policy {
+	case commons.AVUPolicySkip:
+		return []PurgeAction{}, nil
+	case commons.PurgeActionSubtree:
+		return []PurgeAction{
+			{Type: commons.PurgeActionSubtree},
+		}, nil
+	case commons.PurgeActionAncestors:
+		return []PurgeAction{
+			{Type: commons.PurgeActionAncestors, Levels: strings.Count(irodsPath, "/")},
+		}, nil
+	}
+
+	_, arg, _ := commons.ParsePurgeAction(policy)
+	levels, _ := strconv.Atoi(arg)
+	return []PurgeAction{
+		{Type: commons.PurgeActionAncestors, Levels: levels},
+	}, nil
+}
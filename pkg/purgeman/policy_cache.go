@@ -0,0 +1,31 @@
+package purgeman
+
+import (
+	"time"
+)
+
+// CollectionPolicyCache is a LRU cache that keeps AVU policies of iRODS collections, empty if not given
+type CollectionPolicyCache struct {
+	*LRUCache
+}
+
+// NewCollectionPolicyCache creates a new CollectionPolicyCache
+func NewCollectionPolicyCache(maxSize int, ttl time.Duration) *CollectionPolicyCache {
+	return &CollectionPolicyCache{
+		LRUCache: NewLRUCache(maxSize, ttl),
+	}
+}
+
+// Get returns the policy of the collection
+func (cache *CollectionPolicyCache) Get(path string) (string, bool) {
+	value, ok := cache.LRUCache.Get(path)
+	if !ok {
+		return "", false
+	}
+	return value.(string), true
+}
+
+// Put adds or updates the policy of the collection
+func (cache *CollectionPolicyCache) Put(path string, policy string) {
+	cache.LRUCache.Put(path, policy)
+}
@@ -0,0 +1,133 @@
+package purgeman
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+)
+
+func TestExpandPurgeActions(t *testing.T) {
+	const irodsPath = "/iplant/home/user/a.txt"
+
+	tests := []struct {
+		name     string
+		actions  []PurgeAction
+		expected []PurgePath
+	}{
+		{
+			"self keeps the UUID",
+			[]PurgeAction{{Type: commons.PurgeActionSelf}},
+			[]PurgePath{{Path: irodsPath, UUID: "uuid1"}},
+		},
+		{
+			"parent",
+			[]PurgeAction{{Type: commons.PurgeActionParent}},
+			[]PurgePath{{Path: "/iplant/home/user"}},
+		},
+		{
+			"ancestors",
+			[]PurgeAction{{Type: commons.PurgeActionAncestors, Levels: 2}},
+			[]PurgePath{{Path: "/iplant/home/user"}, {Path: "/iplant/home"}},
+		},
+		{
+			"ancestors stop at the root",
+			[]PurgeAction{{Type: commons.PurgeActionAncestors, Levels: 10}},
+			[]PurgePath{{Path: "/iplant/home/user"}, {Path: "/iplant/home"}, {Path: "/iplant"}, {Path: "/"}},
+		},
+		{
+			"subtree",
+			[]PurgeAction{{Type: commons.PurgeActionSubtree}},
+			[]PurgePath{{Path: irodsPath, Subtree: true, UUID: "uuid1"}},
+		},
+		{
+			"template",
+			[]PurgeAction{{Type: commons.PurgeActionTemplate, Template: "{parent}/.thumbnails/{basename}"}},
+			[]PurgePath{{Path: "/iplant/home/user/.thumbnails/a.txt"}},
+		},
+		{
+			"none",
+			[]PurgeAction{{Type: commons.PurgeActionNone}},
+			[]PurgePath{},
+		},
+		{
+			"duplicates are removed",
+			[]PurgeAction{
+				{Type: commons.PurgeActionParent},
+				{Type: commons.PurgeActionSelf},
+				{Type: commons.PurgeActionAncestors, Levels: 1},
+				{Type: commons.PurgeActionSubtree},
+			},
+			[]PurgePath{{Path: "/iplant/home/user"}, {Path: irodsPath, UUID: "uuid1"}, {Path: irodsPath, Subtree: true, UUID: "uuid1"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			purgePaths := ExpandPurgeActions(test.actions, irodsPath, "uuid1")
+			if !reflect.DeepEqual(purgePaths, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, purgePaths)
+			}
+		})
+	}
+}
+
+func TestPurgePolicyMatch(t *testing.T) {
+	policy, err := NewPurgePolicy([]commons.PolicyRule{
+		{Events: []string{"collection.*"}, Path: "/iplant/home/shared/**", Actions: []string{"subtree"}},
+		{Events: []string{"data-object.add"}, Actions: []string{"parent"}},
+		{Actions: []string{"self", "ancestors:2"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		eventType string
+		path      string
+		expected  []PurgeAction
+	}{
+		{"event glob and path", "collection.rm", "/iplant/home/shared/a", []PurgeAction{{Type: commons.PurgeActionSubtree}}},
+		{"event type", "data-object.add", "/iplant/home/shared/a.txt", []PurgeAction{{Type: commons.PurgeActionParent}}},
+		{"any event", "collection.rm", "/iplant/home/user/a", []PurgeAction{{Type: commons.PurgeActionSelf}, {Type: commons.PurgeActionAncestors, Levels: 2}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actions, ok := policy.Match(test.eventType, test.path)
+			if !ok || !reflect.DeepEqual(actions, test.expected) {
+				t.Errorf("expected %+v, got %+v (%t)", test.expected, actions, ok)
+			}
+		})
+	}
+}
+
+func TestGetAVUPolicyActions(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		expected []PurgeAction
+		ok       bool
+	}{
+		{"skip", "skip", []PurgeAction{}, true},
+		{"subtree", "subtree", []PurgeAction{{Type: commons.PurgeActionSubtree}}, true},
+		{"all ancestors", "ancestors", []PurgeAction{{Type: commons.PurgeActionAncestors, Levels: 4}}, true},
+		{"ancestors with levels", "ancestors:2", []PurgeAction{{Type: commons.PurgeActionAncestors, Levels: 2}}, true},
+		{"actions not allowed in AVUs", "parent", nil, false},
+		{"unknown", "everything", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actions, err := getAVUPolicyActions(test.policy, "/iplant/home/user/a.txt")
+			if (err == nil) != test.ok {
+				t.Fatalf("expected ok %t, got %v", test.ok, err)
+			}
+
+			if !reflect.DeepEqual(actions, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, actions)
+			}
+		})
+	}
+}
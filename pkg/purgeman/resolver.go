@@ -0,0 +1,157 @@
+package purgeman
+
+import (
+	"strings"
+
+	irodsfs_clientfs "github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/purgeman/pkg/commons"
+	log "github.com/sirupsen/logrus"
+)
+
+// resolveIRODSPaths returns paths of the event that does not have a path
+// resolution strategies are tried in the configured order until one returns paths
+func (svc *PurgemanService) resolveIRODSPaths(event *FSEvent) []string {
+	for _, strategy := range svc.Config.ResolveStrategies {
+		var paths []string
+
+		switch strategy {
+		case commons.ResolveStrategyMessage:
+			paths = svc.resolveIRODSPathsFromMessage(event)
+		case commons.ResolveStrategyUUID:
+			paths = svc.resolveIRODSPathsByUUID(event.UUID)
+		case commons.ResolveStrategyDataID:
+			paths = svc.resolveIRODSPathsByDataID(event)
+		}
+
+		if len(paths) > 0 {
+			return paths
+		}
+	}
+
+	return nil
+}
+
+// resolveIRODSPathsFromMessage returns a path carried in the message body
+func (svc *PurgemanService) resolveIRODSPathsFromMessage(event *FSEvent) []string {
+	path := getBodyString(event.Body, svc.Config.ResolveMessagePathField)
+	if len(path) == 0 || !strings.HasPrefix(path, "/") {
+		return nil
+	}
+
+	return []string{path}
+}
+
+// resolveIRODSPathsByUUID returns paths from uuid, iRODS is queried only when the uuid is not cached
+func (svc *PurgemanService) resolveIRODSPathsByUUID(uuid string) []string {
+	if len(uuid) == 0 {
+		return nil
+	}
+
+	if path, ok := svc.UUIDCache.Get(uuid); ok {
+		svc.Metrics.UUIDResolved(UUIDResolutionHit)
+		return []string{path}
+	}
+
+	paths := svc.fetchIRODSPathsByUUID(uuid)
+	if len(paths) > 0 {
+		svc.Metrics.UUIDResolved(UUIDResolutionMiss)
+	} else {
+		svc.Metrics.UUIDResolved(UUIDResolutionFailure)
+	}
+	return paths
+}
+
+// resolveIRODSPathsByDataID returns paths from data object or collection id carried in the message body
+func (svc *PurgemanService) resolveIRODSPathsByDataID(event *FSEvent) []string {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgemanService",
+		"function": "resolveIRODSPathsByDataID",
+	})
+
+	dataID := getBodyString(event.Body, svc.Config.ResolveDataIDField)
+	if len(dataID) == 0 {
+		return nil
+	}
+
+	isCollection := strings.HasPrefix(event.EventType, "collection.")
+
+	var paths []string
+	err := svc.withIRODSClient(func(fsClient *irodsfs_clientfs.FileSystem) error {
+		conn, err := fsClient.Session.AcquireConnection()
+		if err != nil {
+			return err
+		}
+		defer fsClient.Session.ReturnConnection(conn)
+
+		logger.Infof("fetching iRODS Path from ID %s", dataID)
+		paths, err = queryIRODSPathsByID(conn, dataID, isCollection)
+		return err
+	})
+
+	if err != nil {
+		logger.WithError(err).Errorf("Failed to search iRODS entries with ID %s", dataID)
+		return nil
+	}
+
+	return paths
+}
+
+// updateUUIDCache updates uuid to path mappings using paths given in the event
+func (svc *PurgemanService) updateUUIDCache(event *FSEvent) {
+	if len(event.UUID) == 0 {
+		return
+	}
+
+	switch event.EventType {
+	case "data-object.add", "collection.add", "data-object.mv":
+		svc.UUIDCache.Put(event.UUID, event.Path)
+	case "collection.mv":
+		// paths of all entries under the collection are also changed
+		svc.UUIDCache.MovePrefix(event.OldPath, event.Path)
+		svc.UUIDCache.Put(event.UUID, event.Path)
+	case "data-object.rm":
+		svc.UUIDCache.Remove(event.UUID)
+	case "collection.rm":
+		svc.UUIDCache.RemovePrefix(event.Path)
+		svc.UUIDCache.Remove(event.UUID)
+	}
+}
+
+// fetchIRODSPathsByUUID returns paths from uuid, returns empty if not found
+func (svc *PurgemanService) fetchIRODSPathsByUUID(uuid string) []string {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgemanService",
+		"function": "fetchIRODSPathsByUUID",
+	})
+
+	paths := []string{}
+	err := svc.withIRODSClient(func(fsClient *irodsfs_clientfs.FileSystem) error {
+		logger.Infof("fetching iRODS Path from UUID %s", uuid)
+		entries, err := fsClient.SearchByMeta(svc.Config.UUIDAttribute, uuid)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			// full path of the data object or the collection
+			paths = append(paths, entry.Path)
+		}
+		return nil
+	})
+
+	if err != nil {
+		logger.WithError(err).Errorf("Failed to search iRODS entries with UUID %s", uuid)
+		return nil
+	}
+
+	if len(paths) == 1 {
+		svc.UUIDCache.Put(uuid, paths[0])
+	} else if len(paths) > 1 {
+		// multiple entries share the uuid, handle all of them but do not cache
+		logger.Warnf("Found %d iRODS entries with UUID %s", len(paths), uuid)
+	}
+
+	return paths
+}
@@ -0,0 +1,74 @@
+package purgeman
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+)
+
+func TestResolveIRODSPaths(t *testing.T) {
+	tests := []struct {
+		name       string
+		strategies []string
+		event      *FSEvent
+		expected   []string
+	}{
+		{
+			"path in the message",
+			[]string{commons.ResolveStrategyMessage, commons.ResolveStrategyUUID},
+			&FSEvent{UUID: "uuid1", Body: map[string]interface{}{"path": "/iplant/home/user/b.txt"}},
+			[]string{"/iplant/home/user/b.txt"},
+		},
+		{
+			"relative path in the message",
+			[]string{commons.ResolveStrategyMessage, commons.ResolveStrategyUUID},
+			&FSEvent{UUID: "uuid1", Body: map[string]interface{}{"path": "b.txt"}},
+			[]string{"/iplant/home/user/a.txt"},
+		},
+		{
+			"cached uuid",
+			[]string{commons.ResolveStrategyMessage, commons.ResolveStrategyUUID},
+			&FSEvent{UUID: "uuid1", Body: map[string]interface{}{}},
+			[]string{"/iplant/home/user/a.txt"},
+		},
+		{
+			"strategies in order",
+			[]string{commons.ResolveStrategyUUID, commons.ResolveStrategyMessage},
+			&FSEvent{UUID: "uuid1", Body: map[string]interface{}{"path": "/iplant/home/user/b.txt"}},
+			[]string{"/iplant/home/user/a.txt"},
+		},
+		{
+			"message strategy not configured",
+			[]string{commons.ResolveStrategyUUID},
+			&FSEvent{Body: map[string]interface{}{"path": "/iplant/home/user/b.txt"}},
+			nil,
+		},
+		{
+			"unknown uuid without iRODS",
+			[]string{commons.ResolveStrategyMessage, commons.ResolveStrategyUUID},
+			&FSEvent{UUID: "uuid2", Body: map[string]interface{}{}},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := commons.NewDefaultConfig()
+			config.ResolveStrategies = test.strategies
+
+			svc, err := NewPurgeman(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer svc.Destroy()
+
+			svc.UUIDCache.Put("uuid1", "/iplant/home/user/a.txt")
+
+			paths := svc.resolveIRODSPaths(test.event)
+			if !reflect.DeepEqual(paths, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, paths)
+			}
+		})
+	}
+}
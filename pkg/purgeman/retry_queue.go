@@ -0,0 +1,136 @@
+package purgeman
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// retryQueueEntry is an entry of RetryQueue
+type retryQueueEntry struct {
+	Event   *FSEvent
+	DueTime time.Time
+}
+
+// RetryQueue is a delayed queue for events that need to be handled again later
+type RetryQueue struct {
+	Delay   time.Duration
+	MaxSize int
+
+	queue     *list.List
+	wakeup    chan bool
+	stop      chan bool
+	terminate bool
+	mutex     sync.Mutex
+}
+
+// NewRetryQueue creates a new RetryQueue
+func NewRetryQueue(delay time.Duration, maxSize int) *RetryQueue {
+	return &RetryQueue{
+		Delay:   delay,
+		MaxSize: maxSize,
+		queue:   list.New(),
+		wakeup:  make(chan bool, 1),
+		stop:    make(chan bool),
+	}
+}
+
+// Push adds an event to the queue, the event will be handled after the delay
+// returns false if the queue is full or stopped
+func (queue *RetryQueue) Push(event *FSEvent) bool {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	if queue.terminate {
+		return false
+	}
+
+	if queue.MaxSize > 0 && queue.queue.Len() >= queue.MaxSize {
+		return false
+	}
+
+	// all events have the same delay, so the queue is always sorted by due time
+	queue.queue.PushBack(&retryQueueEntry{
+		Event:   event,
+		DueTime: time.Now().Add(queue.Delay),
+	})
+
+	select {
+	case queue.wakeup <- true:
+	default:
+	}
+	return true
+}
+
+// Len returns the number of events waiting in the queue
+func (queue *RetryQueue) Len() int {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	return queue.queue.Len()
+}
+
+// Flush drops all events waiting in the queue, returns the number of dropped events
+func (queue *RetryQueue) Flush() int {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	count := queue.queue.Len()
+	queue.queue.Init()
+	return count
+}
+
+// Run calls the handler for events when they are due, returns when the queue is stopped
+// it waits for a push while the queue is empty, so it never spins even if the delay is 0
+func (queue *RetryQueue) Run(handler FSEventHandler) {
+	for {
+		// nil until an event is waiting, receiving from it blocks
+		var due <-chan time.Time
+
+		dueEvents := []*FSEvent{}
+		queue.mutex.Lock()
+		if queue.terminate {
+			queue.mutex.Unlock()
+			return
+		}
+
+		now := time.Now()
+		for queue.queue.Len() > 0 {
+			front := queue.queue.Front()
+			entry := front.Value.(*retryQueueEntry)
+			if entry.DueTime.After(now) {
+				due = time.After(entry.DueTime.Sub(now))
+				break
+			}
+
+			dueEvents = append(dueEvents, entry.Event)
+			queue.queue.Remove(front)
+		}
+		queue.mutex.Unlock()
+
+		for _, event := range dueEvents {
+			go handler(event)
+		}
+
+		select {
+		case <-queue.stop:
+			return
+		case <-queue.wakeup:
+		case <-due:
+		}
+	}
+}
+
+// Stop stops the queue, events waiting in the queue are dropped
+func (queue *RetryQueue) Stop() {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	if queue.terminate {
+		return
+	}
+
+	queue.terminate = true
+	queue.queue.Init()
+	close(queue.stop)
+}
@@ -0,0 +1,92 @@
+package purgeman
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryQueuePush(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxSize  int
+		stopped  bool
+		pushes   int
+		accepted int
+	}{
+		{"unlimited", 0, false, 5, 5},
+		{"limited", 2, false, 5, 2},
+		{"stopped", 0, true, 2, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			queue := NewRetryQueue(time.Hour, test.maxSize)
+			if test.stopped {
+				queue.Stop()
+			}
+
+			accepted := 0
+			for idx := 0; idx < test.pushes; idx++ {
+				if queue.Push(&FSEvent{UUID: "uuid"}) {
+					accepted++
+				}
+			}
+
+			if accepted != test.accepted {
+				t.Errorf("expected %d accepted events, got %d", test.accepted, accepted)
+			}
+
+			if queue.Len() != test.accepted {
+				t.Errorf("expected %d waiting events, got %d", test.accepted, queue.Len())
+			}
+		})
+	}
+}
+
+func TestRetryQueueRunHandlesDueEvents(t *testing.T) {
+	for _, delay := range []time.Duration{0, 10 * time.Millisecond} {
+		queue := NewRetryQueue(delay, 0)
+
+		handled := make(chan *FSEvent, 2)
+		stopped := make(chan bool)
+		go func() {
+			queue.Run(func(event *FSEvent) {
+				handled <- event
+			})
+			close(stopped)
+		}()
+
+		queue.Push(&FSEvent{UUID: "uuid1"})
+		queue.Push(&FSEvent{UUID: "uuid2"})
+
+		for idx := 0; idx < 2; idx++ {
+			select {
+			case <-handled:
+			case <-time.After(time.Second):
+				t.Fatalf("expected events to be handled after %s", delay)
+			}
+		}
+
+		queue.Stop()
+
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatalf("expected Run to return when stopped")
+		}
+	}
+}
+
+func TestRetryQueueFlush(t *testing.T) {
+	queue := NewRetryQueue(time.Hour, 0)
+	queue.Push(&FSEvent{UUID: "uuid1"})
+	queue.Push(&FSEvent{UUID: "uuid2"})
+
+	if flushed := queue.Flush(); flushed != 2 {
+		t.Errorf("expected 2 flushed events, got %d", flushed)
+	}
+
+	if queue.Len() != 0 {
+		t.Errorf("expected an empty queue, got %d", queue.Len())
+	}
+}
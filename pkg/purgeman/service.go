@@ -1,11 +1,11 @@
 package purgeman
 
 import (
+	"fmt"
 	"net/http"
-	"net/url"
-	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	irodsfs_clientfs "github.com/cyverse/go-irodsclient/fs"
@@ -14,20 +14,140 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// StatsReportInterval is an interval to report UUID cache, event lag and event filter stats
+	StatsReportInterval = 10 * time.Minute
+	// RetryWaitInterval is an interval to check if events waiting for retry are handled before stopping a replay
+	RetryWaitInterval = 100 * time.Millisecond
+)
+
 // PurgemanService is a service object
 type PurgemanService struct {
+	InFlight               int64 // number of events being handled, first to be aligned for atomic operations
 	Config                 *commons.Config
+	Targets                []*PurgeTarget
+	EventFilter            *EventFilter
+	Policy                 *PurgePolicy
+	PathFilter             *PathFilter
 	IRODSClient            *irodsfs_clientfs.FileSystem
+	IRODSMutex             sync.RWMutex // protects IRODSClient
+	IRODSLookupSemaphore   chan struct{}
 	MessageQueueConnection *IRODSMessageQueueConnection
+	UUIDCache              *UUIDPathCache
+	PolicyCache            *CollectionPolicyCache
+	ACLCache               *AnonymousAccessCache
+	RetryQueue             *RetryQueue
+	DeadLetterWriter       *DeadLetterWriter
+	AuditJournal           *AuditJournal  // nil if disabled
+	Capture                *CaptureWriter // nil if disabled
+	Canaries               *CanaryTracker
+	PendingEvents          *PendingEventBuffer
+	Lag                    *LagTracker
+	Metrics                *Metrics
+	Health                 *HealthTracker
+	HTTPServer             *http.Server
+	AMQPPause              *PauseSwitch
 	Terminate              bool
+	TerminateChan          chan bool
 	Mutex                  sync.Mutex
 }
 
 // NewPurgeman creates a new purgeman service
 func NewPurgeman(config *commons.Config) (*PurgemanService, error) {
-	return &PurgemanService{
-		Config: config,
-	}, nil
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"function": "NewPurgeman",
+	})
+
+	metrics := NewMetrics()
+	health := NewHealthTracker()
+
+	var dryRunWriter *DryRunWriter
+	if config.DryRun {
+		dryRunWriter = NewDryRunWriter(config.DryRunPath)
+	}
+
+	targets, err := newPurgeTargets(config, metrics, health, dryRunWriter)
+	if err != nil {
+		return nil, err
+	}
+
+	eventFilter, err := NewEventFilter(config.GetEventFilters())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create an event filter - %v", err)
+	}
+
+	policy, err := NewPurgePolicy(config.GetPolicyRules())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a purge policy - %v", err)
+	}
+
+	pathFilter, err := NewPathFilter(config.PathIncludes, config.PathExcludes)
+	if err != nil {
+		return nil, err
+	}
+
+	// files below are shared with the service running with the same config, so a dry-run must not touch them
+	deadLetterPath := config.DeadLetterPath
+	pendingSpillPath := config.PendingSpillPath
+	capturePath := config.CapturePath
+	if config.DryRun {
+		for _, path := range []string{deadLetterPath, pendingSpillPath, capturePath} {
+			if len(path) > 0 {
+				logger.Warnf("Ignoring %s in dry-run mode", path)
+			}
+		}
+
+		deadLetterPath = ""
+		pendingSpillPath = ""
+		capturePath = ""
+	}
+
+	var deadLetterWriter *DeadLetterWriter
+	if len(deadLetterPath) > 0 {
+		deadLetterWriter = NewDeadLetterWriter(deadLetterPath)
+	}
+
+	// deliveries are not received from AMQP while replaying a capture file
+	var capture *CaptureWriter
+	if len(capturePath) > 0 && len(config.ReplayCapturePath) == 0 {
+		capture = NewCaptureWriter(capturePath)
+	}
+
+	// purges are not made in dry-run mode
+	var auditJournal *AuditJournal
+	if len(config.AuditJournalPath) > 0 && !config.DryRun {
+		auditJournal = NewAuditJournal(config.AuditJournalPath, config.AuditJournalMaxSize, config.AuditJournalMaxBackups)
+	}
+
+	svc := &PurgemanService{
+		Config:               config,
+		Targets:              targets,
+		EventFilter:          eventFilter,
+		Policy:               policy,
+		PathFilter:           pathFilter,
+		IRODSLookupSemaphore: make(chan struct{}, config.IRODSConnectionMax),
+		UUIDCache:            NewUUIDPathCache(config.UUIDCacheSize, config.UUIDCacheTTL),
+		PolicyCache:          NewCollectionPolicyCache(config.AVUPolicyCacheSize, config.AVUPolicyCacheTTL),
+		ACLCache:             NewAnonymousAccessCache(config.ACLCacheSize, config.ACLCacheTTL),
+		RetryQueue:           NewRetryQueue(config.RetryDelay, config.RetryQueueSize),
+		DeadLetterWriter:     deadLetterWriter,
+		AuditJournal:         auditJournal,
+		Capture:              capture,
+		Canaries:             NewCanaryTracker(CanaryTrackerSize),
+		PendingEvents:        NewPendingEventBuffer(config.PendingBufferSize, pendingSpillPath, config.PendingSpillSize),
+		Lag:                  NewLagTracker(),
+		Metrics:              metrics,
+		Health:               health,
+		AMQPPause:            NewPauseSwitch(),
+		TerminateChan:        make(chan bool),
+	}
+
+	metrics.registerServiceGauges(svc)
+
+	health.Set(ComponentAMQP, false, "not connected yet")
+	health.Set(ComponentIRODS, false, "not connected yet")
+	return svc, nil
 }
 
 func (svc *PurgemanService) connectIRODS() error {
@@ -37,8 +157,8 @@ func (svc *PurgemanService) connectIRODS() error {
 		"function": "connectIRODS",
 	})
 
-	svc.Mutex.Lock()
-	defer svc.Mutex.Unlock()
+	svc.IRODSMutex.Lock()
+	defer svc.IRODSMutex.Unlock()
 
 	if svc.IRODSClient == nil {
 		logger.Info("Connecting to iRODS")
@@ -49,7 +169,12 @@ func (svc *PurgemanService) connectIRODS() error {
 		}
 
 		// connect to iRODS
-		fsclient, err := irodsfs_clientfs.NewFileSystemWithDefault(iRODSAccount, "purgeman")
+		// the file system manages a pool of connections, so lookups can run in parallel
+		fsConfig := irodsfs_clientfs.NewFileSystemConfigWithDefault("purgeman")
+		fsConfig.ConnectionMax = svc.Config.IRODSConnectionMax
+		fsConfig.OperationTimeout = svc.Config.IRODSOperationTimeout
+
+		fsclient, err := irodsfs_clientfs.NewFileSystem(iRODSAccount, fsConfig)
 		if err != nil {
 			log.WithError(err).Errorf("Error connecting to iRODS")
 			return err
@@ -80,6 +205,12 @@ func (svc *PurgemanService) connectMessageQueue() error {
 			Port:     svc.Config.AMQPPort,
 			VHost:    svc.Config.AMQPVHost,
 			Exchange: svc.Config.AMQPExchange,
+
+			QueueExpiry: svc.Config.AMQPQueueExpiry,
+
+			TimestampField: svc.Config.EventTimestampField,
+			// declares a queue named differently from the one of the service
+			DryRun: svc.Config.DryRun,
 		}
 
 		// connect to AMQP
@@ -89,6 +220,10 @@ func (svc *PurgemanService) connectMessageQueue() error {
 			return err
 		}
 
+		mqConn.Metrics = svc.Metrics
+		mqConn.Health = svc.Health
+		mqConn.Pause = svc.AMQPPause
+		mqConn.Capture = svc.Capture
 		svc.MessageQueueConnection = mqConn
 	}
 	return nil
@@ -102,36 +237,83 @@ func (svc *PurgemanService) Start() error {
 	})
 
 	logger.Info("Starting the purgeman service")
+	if svc.Config.DryRun {
+		logger.Warn("Running in dry-run mode, purge requests are recorded but not sent")
+	}
+
+	// the spill file is owned by the service from now on
+	err := svc.PendingEvents.Recover()
+	if err != nil {
+		logger.WithError(err).Error("Failed to recover spilled events")
+	}
+
 	wg := sync.WaitGroup{}
 
+	if svc.Config.RetryAttempts > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// returns when the service is destroyed
+			svc.RetryQueue.Run(svc.fsEventHandler)
+		}()
+	}
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 
-		for {
-			svc.Mutex.Lock()
-			if svc.Terminate {
-				svc.Mutex.Unlock()
-				return
-			}
-			svc.Mutex.Unlock()
+		// returns when the service is destroyed
+		svc.monitorIRODS()
+	}()
 
-			err := svc.connectIRODS()
-			if err == nil {
-				// now connected to iRODS.
-				// if disconnected for any reason, iRODS session manage will handle it
-				return
-			}
+	if svc.Config.TargetProbeInterval > 0 && !svc.Config.DryRun {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
 
-			logger.WithError(err).Error("Failed to connect to iRODS, retry after 1 min")
-			time.Sleep(1 * time.Minute)
-		}
-	}()
+			// returns when the service is destroyed
+			svc.monitorTargets()
+		}()
+	}
+
+	if svc.Config.CanaryInterval > 0 && svc.Config.DryRun {
+		// canaries are published to the shared exchange
+		logger.Warn("Canaries are not published in dry-run mode")
+	} else if svc.Config.CanaryInterval > 0 && len(svc.Config.ReplayCapturePath) == 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// returns when the service is destroyed
+			svc.runCanary()
+		}()
+	}
+
+	if len(svc.Config.HTTPListen) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// returns when the service is destroyed
+			err := svc.runHTTPServer()
+			if err != nil {
+				logger.WithError(err).Error("Failed to run the HTTP server")
+			}
+		}()
+	}
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 
+		if len(svc.Config.ReplayCapturePath) > 0 {
+			// stops the service when all deliveries are replayed
+			svc.replayCapture()
+			return
+		}
+
+		connectedBefore := false
 		for {
 			svc.Mutex.Lock()
 			if svc.Terminate {
@@ -143,6 +325,12 @@ func (svc *PurgemanService) Start() error {
 			err := svc.connectMessageQueue()
 			if err == nil {
 				// connected
+				svc.Metrics.SetConnected(ComponentAMQP, true)
+				if connectedBefore {
+					svc.Metrics.Reconnected(ComponentAMQP)
+				}
+				connectedBefore = true
+
 				// will not return until it fails to receive messages
 				err = svc.MessageQueueConnection.MonitorFSChanges(svc.fsEventHandler)
 				if err != nil {
@@ -153,6 +341,10 @@ func (svc *PurgemanService) Start() error {
 				svc.Mutex.Lock()
 				svc.MessageQueueConnection.Disconnect()
 				svc.MessageQueueConnection = nil
+				svc.Metrics.SetConnected(ComponentAMQP, false)
+				if err == nil {
+					svc.Health.Set(ComponentAMQP, false, "disconnected")
+				}
 
 				// is the failure due to termination?
 				if svc.Terminate {
@@ -164,8 +356,37 @@ func (svc *PurgemanService) Start() error {
 				// fall below for retry
 			}
 
+			svc.Health.SetError(ComponentAMQP, err)
 			logger.WithError(err).Error("Failed to connect to MessageQueue, retry after 1 min")
-			time.Sleep(1 * time.Minute)
+			if !svc.sleep(1 * time.Minute) {
+				// terminated
+				return
+			}
+		}
+	}()
+
+	// report stats periodically, this does not block termination
+	go func() {
+		for {
+			time.Sleep(StatsReportInterval)
+
+			svc.Mutex.Lock()
+			if svc.Terminate {
+				svc.Mutex.Unlock()
+				return
+			}
+			svc.Mutex.Unlock()
+
+			hits, misses := svc.UUIDCache.Stats()
+			logger.Infof("UUID cache stats - entries: %d, hits: %d, misses: %d", svc.UUIDCache.Len(), hits, misses)
+
+			lastLag, maxLag, dropped := svc.Lag.Stats()
+			logger.Infof("Event lag stats - last: %s, max: %s, dropped old events: %d", lastLag, maxLag, dropped)
+
+			skipped := svc.EventFilter.Stats()
+			for _, name := range svc.EventFilter.RuleNames() {
+				logger.Infof("Event filter stats - %s: %d events skipped", name, skipped[name])
+			}
 		}
 	}()
 
@@ -182,10 +403,9 @@ func (svc *PurgemanService) Destroy() {
 	})
 
 	svc.Mutex.Lock()
-	defer svc.Mutex.Unlock()
-
 	if svc.Terminate {
 		// already terminated
+		svc.Mutex.Unlock()
 		return
 	}
 
@@ -193,185 +413,497 @@ func (svc *PurgemanService) Destroy() {
 
 	logger.Info("Destroying the purgeman service")
 
-	if svc.IRODSClient != nil {
-		svc.IRODSClient.Release()
-		svc.IRODSClient = nil
-	}
+	close(svc.TerminateChan)
+	svc.RetryQueue.Stop()
 
 	if svc.MessageQueueConnection != nil {
 		svc.MessageQueueConnection.Disconnect()
 		svc.MessageQueueConnection = nil
 	}
+
+	httpServer := svc.HTTPServer
+	svc.HTTPServer = nil
+	svc.Mutex.Unlock()
+
+	// waits below must not hold svc.Mutex, requests in progress and lookups may need it
+	svc.disconnectIRODS()
+	stopHTTPServer(httpServer)
+
+	if svc.AuditJournal != nil {
+		svc.AuditJournal.Close()
+	}
 }
 
-// fetchIRODSPath returns path from uuid
-func (svc *PurgemanService) fetchIRODSPath(uuid string) string {
+// replayCapture feeds deliveries in the capture file to the event handler instead of AMQP, and stops the service when done
+func (svc *PurgemanService) replayCapture() {
 	logger := log.WithFields(log.Fields{
 		"package":  "purgeman",
 		"struct":   "PurgemanService",
-		"function": "fetchIRODSPath",
+		"function": "replayCapture",
 	})
 
+	source := &ReplayEventSource{
+		Path:           svc.Config.ReplayCapturePath,
+		Speed:          svc.Config.ReplaySpeed,
+		TimestampField: svc.Config.EventTimestampField,
+		Metrics:        svc.Metrics,
+		Sequential:     svc.Config.ReplaySequential,
+	}
+
+	logger.Infof("Replaying deliveries captured in %s", source.Path)
+	svc.Health.Set(ComponentAMQP, true, fmt.Sprintf("replaying %s", source.Path))
+
+	replayed, err := source.Run(svc.fsEventHandler, svc.TerminateChan)
+	if err != nil {
+		logger.WithError(err).Errorf("Failed to replay deliveries captured in %s", source.Path)
+	}
+
+	logger.Infof("Replayed %d deliveries, waiting for %d events waiting for retry", replayed, svc.RetryQueue.Len())
+	if svc.waitForRetries() {
+		logger.Infof("Handled all events, dropping %d pending events", svc.PendingEvents.Len())
+	}
+	svc.Health.Set(ComponentAMQP, false, "replay finished")
+
+	svc.Destroy()
+}
+
+// waitForRetries waits until events waiting for retry and events in progress are handled
+// returns false if the service is terminated while waiting
+func (svc *PurgemanService) waitForRetries() bool {
+	for svc.RetryQueue.Len() > 0 || atomic.LoadInt64(&svc.InFlight) > 0 {
+		if !svc.sleep(RetryWaitInterval) {
+			return false
+		}
+	}
+	return true
+}
+
+// isTerminated returns true if the service is terminated
+func (svc *PurgemanService) isTerminated() bool {
 	svc.Mutex.Lock()
 	defer svc.Mutex.Unlock()
 
-	if svc.Terminate {
-		return ""
+	return svc.Terminate
+}
+
+// sleep waits for the duration, returns false if the service is terminated while waiting
+func (svc *PurgemanService) sleep(duration time.Duration) bool {
+	select {
+	case <-svc.TerminateChan:
+		return false
+	case <-time.After(duration):
+		return true
 	}
+}
 
-	if svc.IRODSClient == nil {
-		logger.Errorf("Failed to connect to iRODS")
-		return ""
+// getIRODSClient returns current iRODS client, returns nil if not connected
+func (svc *PurgemanService) getIRODSClient() *irodsfs_clientfs.FileSystem {
+	svc.IRODSMutex.RLock()
+	defer svc.IRODSMutex.RUnlock()
+
+	return svc.IRODSClient
+}
+
+// withIRODSClient calls the function with current iRODS client
+// concurrent calls are limited to the number of iRODS connections
+// the client may be released by a disconnect while in use, then the call fails on its own
+func (svc *PurgemanService) withIRODSClient(fn func(fsClient *irodsfs_clientfs.FileSystem) error) error {
+	if svc.isTerminated() {
+		return fmt.Errorf("service is terminated")
 	}
 
-	logger.Infof("fetching iRODS Path from UUID %s", uuid)
-	entries, err := svc.IRODSClient.SearchByMeta("ipc_UUID", uuid)
-	if err == nil {
-		// only one entry must be found
-		if len(entries) == 1 {
-			// return full path of the data object or the collection
-			return entries[0].Path
-		}
+	svc.IRODSLookupSemaphore <- struct{}{}
+	defer func() {
+		<-svc.IRODSLookupSemaphore
+	}()
+
+	fsClient := svc.getIRODSClient()
+	if fsClient == nil {
+		return fmt.Errorf("not connected to iRODS")
 	}
 
-	// if we couldn't find, return empty string
-	return ""
+	return fn(fsClient)
 }
 
 // fsEventHandler handles a fs event
-func (svc *PurgemanService) fsEventHandler(eventtype string, path string, uuid string) {
+func (svc *PurgemanService) fsEventHandler(event *FSEvent) {
 	logger := log.WithFields(log.Fields{
 		"package":  "purgeman",
 		"struct":   "PurgemanService",
 		"function": "fsEventHandler",
 	})
 
-	iRODSPath := path
-	if len(path) == 0 && len(uuid) > 0 {
-		// conv uuid to path
-		iRODSPath = svc.fetchIRODSPath(uuid)
-	}
-
-	if len(iRODSPath) > 0 {
-		logger.Infof("Reveiced a %s event on file %s", eventtype, iRODSPath)
-
-		switch eventtype {
-		case "data-object.add":
-			// It should purge the parent collection’s path.
-			svc.purgeCacheParent(iRODSPath)
-		case "data-object.rm":
-			// It should purge data object’s path and parent collection’s path.
-			svc.purgeCacheParentAndMe(iRODSPath)
-		case "data-object.mv":
-			// It should purge the data object's old path,
-			// and if the object was moved to a new parent collection,
-			// it should purge the old parent collection’s path.
-			svc.purgeCacheParentAndMe(iRODSPath)
-		case "collection.add":
-			// It should purge the parent collection’s path.
-			svc.purgeCacheParent(iRODSPath)
-		case "collection.rm":
-			// It should purge data object’s path and parent collection’s path.
-			svc.purgeCacheParentAndMe(iRODSPath)
-		case "collection.mv":
-			// It should purge the collection's old path,
-			// and if the collection was moved to a new parent collection,
-			// purge the old parent collection’s path
-			svc.purgeCacheParentAndMe(iRODSPath)
-		case "data-object.mod":
-			// It should purge the data object’s path.
-			// but also the parent collection to renew new file size of data object
-			svc.purgeCacheParentAndMe(iRODSPath)
-		case "data-object.sys-metadata.mod":
-			// It should purge the data object’s path.
-			svc.purgeCacheParentAndMe(iRODSPath)
-		default:
-			logger.Infof("Reveiced an unknown event %s", eventtype)
+	atomic.AddInt64(&svc.InFlight, 1)
+	defer atomic.AddInt64(&svc.InFlight, -1)
+
+	// retried or replayed events are counted already
+	firstHandling := event.Attempts == 0 && !event.Replayed
+
+	// paths in ignored or expired events are still valid, the cache must follow them before any filtering
+	svc.updateUUIDCache(event)
+
+	if !event.Timestamp.IsZero() {
+		if event.Attempts == 0 {
+			svc.Lag.Observe(time.Since(event.Timestamp))
+		}
+
+		if svc.isExpiredForAllTargets(event.Timestamp) {
+			svc.Lag.Drop()
+			svc.Metrics.EventIgnored(EventIgnoredExpired)
+			logger.Debugf("Dropping a %s event on file UUID %s - older than max age of all targets (%s)", event.EventType, event.UUID, event.Timestamp)
+			svc.recordSkippedEvent(event, event.Path, "older than max age of all targets")
+			return
 		}
+	}
+
+	if ruleName, ignored := svc.EventFilter.Ignores(event); ignored {
+		svc.Metrics.EventIgnored(EventIgnoredFilter)
+		logger.Debugf("Ignoring a %s event on file UUID %s - matches event filter %s", event.EventType, event.UUID, ruleName)
+		svc.recordSkippedEvent(event, event.Path, fmt.Sprintf("event filter %s", ruleName))
+		return
+	}
+
+	if firstHandling {
+		svc.Metrics.EventAccepted(event.EventType)
+	}
+
+	iRODSPaths := []string{}
+	if len(event.OldPath) > 0 {
+		iRODSPaths = append(iRODSPaths, event.OldPath)
+	}
+
+	if len(event.Path) > 0 {
+		iRODSPaths = append(iRODSPaths, event.Path)
 	} else {
-		logger.Infof("Reveiced a %s event on file UUID %s, but could not resolve", eventtype, uuid)
+		// conv uuid or data object id to path
+		resolvedPaths := svc.resolveIRODSPaths(event)
+		if len(resolvedPaths) == 0 {
+			if !svc.isIRODSAvailable() {
+				// keep the event until iRODS becomes available
+				svc.bufferPendingEvent(event)
+				return
+			}
+
+			logger.Infof("Reveiced a %s event on file UUID %s, but could not resolve", event.EventType, event.UUID)
+			svc.retryUnresolvedEvent(event)
+			return
+		}
+
+		iRODSPaths = append(iRODSPaths, resolvedPaths...)
+	}
+
+	for _, iRODSPath := range iRODSPaths {
+		if !svc.PathFilter.Accepts(iRODSPath) {
+			svc.Metrics.EventIgnored(EventIgnoredPathFilter)
+			logger.Debugf("Ignoring a %s event on %s - filtered out", event.EventType, iRODSPath)
+			svc.recordSkippedEvent(event, iRODSPath, "filtered out")
+			continue
+		}
+
+		svc.purgeCacheForEvent(event, iRODSPath)
 	}
 }
 
-func (svc *PurgemanService) purgeCacheParentAndMe(path string) {
-	svc.purgeCacheParent(path)
-	svc.purgeCache(path)
+// isExpiredForAllTargets checks if objects cached before the event time have expired in all targets
+func (svc *PurgemanService) isExpiredForAllTargets(eventTime time.Time) bool {
+	for _, target := range svc.Targets {
+		if !target.IsExpired(eventTime) {
+			return false
+		}
+	}
+	return len(svc.Targets) > 0
 }
 
-func (svc *PurgemanService) purgeCacheParent(path string) {
-	if len(path) > 0 && path != "/" {
-		dirpath := filepath.Dir(path)
-		svc.purgeCache(dirpath)
+// retryUnresolvedEvent puts the event to the retry queue, or to the dead letter if it exceeds max attempts
+func (svc *PurgemanService) retryUnresolvedEvent(event *FSEvent) {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgemanService",
+		"function": "retryUnresolvedEvent",
+	})
+
+	event.Attempts++
+	if event.Attempts > svc.Config.RetryAttempts {
+		svc.deadLetterEvent(event, fmt.Sprintf("could not resolve UUID after %d attempts", event.Attempts))
+		return
 	}
+
+	if !svc.RetryQueue.Push(event) {
+		svc.deadLetterEvent(event, "retry queue is full")
+		return
+	}
+
+	logger.Infof("Retry a %s event on file UUID %s after %s (%d/%d)", event.EventType, event.UUID, svc.Config.RetryDelay, event.Attempts, svc.Config.RetryAttempts)
 }
 
-// purgeCache purges cache
-func (svc *PurgemanService) purgeCache(path string) {
+// deadLetterEvent records the event that could not be handled
+func (svc *PurgemanService) deadLetterEvent(event *FSEvent, reason string) {
 	logger := log.WithFields(log.Fields{
 		"package":  "purgeman",
 		"struct":   "PurgemanService",
-		"function": "purgeCache",
+		"function": "deadLetterEvent",
 	})
 
-	// purge cache on the path
-	logger.Infof("Purging a cache for %s", path)
+	logger.Errorf("Dropping a %s event on file UUID %s - %s", event.EventType, event.UUID, reason)
+	svc.recordSkippedEvent(event, event.Path, fmt.Sprintf("dead letter - %s", reason))
 
-	wg := sync.WaitGroup{}
-	for idx, varnishURL := range svc.Config.VarnishURLPrefixes {
-		wg.Add(1)
+	if svc.DeadLetterWriter != nil {
+		err := svc.DeadLetterWriter.Write(event, reason)
+		if err != nil {
+			logger.WithError(err).Error("Failed to write a dead letter")
+		}
+	}
+}
 
-		f := func(urlPrefix string) {
-			defer wg.Done()
+// PauseAMQP pauses consumption of AMQP messages, messages are kept in the queue while paused
+func (svc *PurgemanService) PauseAMQP() {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgemanService",
+		"function": "PauseAMQP",
+	})
 
-			urlPrefix = strings.TrimRight(urlPrefix, "/")
-			requestURL := urlPrefix + path
+	if !svc.AMQPPause.Pause() {
+		return
+	}
 
-			hostOverride := ""
-			if idx < len(svc.Config.VarnishHostsOverride) {
-				hostOverride = svc.Config.VarnishHostsOverride[idx]
-			}
+	logger.Info("Pausing consumption of AMQP messages")
 
-			host := ""
-			if len(hostOverride) > 0 {
-				host = hostOverride
-			} else {
-				u, err := url.Parse(requestURL)
-				if err != nil {
-					logger.WithError(err).Errorf("Failed to aprse a request '%s'", requestURL)
-					return
-				}
+	svc.Mutex.Lock()
+	defer svc.Mutex.Unlock()
+
+	if svc.MessageQueueConnection != nil {
+		err := svc.MessageQueueConnection.CancelConsumer()
+		if err != nil {
+			logger.WithError(err).Error("Failed to cancel the AMQP consumer")
+		}
+	}
+}
 
-				host = u.Host
+// ResumeAMQP resumes consumption of AMQP messages
+func (svc *PurgemanService) ResumeAMQP() {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgemanService",
+		"function": "ResumeAMQP",
+	})
+
+	if svc.AMQPPause.Resume() {
+		logger.Info("Resuming consumption of AMQP messages")
+	}
+}
+
+// ConnectIRODS connects to iRODS without monitoring the session
+// this is used to purge paths without starting the service, the session is released when the service is destroyed
+func (svc *PurgemanService) ConnectIRODS() error {
+	err := svc.connectIRODS()
+	if err != nil {
+		svc.Health.SetError(ComponentIRODS, err)
+		return err
+	}
+
+	svc.Health.Set(ComponentIRODS, true, "connected")
+	svc.Metrics.SetConnected(ComponentIRODS, true)
+	return nil
+}
+
+// PurgePaths purges the iRODS paths through targets
+// if the event type is given, policy rules of the event type decide what to purge
+func (svc *PurgemanService) PurgePaths(paths []string, subtree bool, eventType string) []*PurgeResult {
+	results := []*PurgeResult{}
+	for _, path := range paths {
+		if len(eventType) > 0 {
+			event := &FSEvent{
+				EventType: eventType,
+				Path:      path,
+				Manual:    true,
 			}
+			results = append(results, svc.purgeCacheForEvent(event, path)...)
+			continue
+		}
 
-			logger.Infof("Sending a PURGE request to '%s' for host '%s'", requestURL, host)
+		pathResults := svc.purgeCache(PurgePath{
+			Path:    path,
+			Subtree: subtree,
+		})
 
-			req, err := http.NewRequest("PURGE", requestURL, nil)
+		svc.recordPurges(&AuditEntry{
+			Manual:  true,
+			Path:    path,
+			Results: pathResults,
+		})
+
+		results = append(results, pathResults...)
+	}
+	return results
+}
+
+// PurgeResult is a result of purging a path on a target
+type PurgeResult struct {
+	Target  string `json:"target"`
+	Path    string `json:"path"`
+	Subtree bool   `json:"subtree,omitempty"`
+	Skipped string `json:"skipped,omitempty"` // reason if the target did not receive purges
+	Error   string `json:"error,omitempty"`
+
+	Requests []*PurgeRequestResult `json:"requests,omitempty"`
+}
+
+// purgeCacheForEvent purges cache for the path as the policy rules decide
+func (svc *PurgemanService) purgeCacheForEvent(event *FSEvent, iRODSPath string) []*PurgeResult {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgemanService",
+		"function": "purgeCacheForEvent",
+	})
+
+	eventtype := event.EventType
+
+	logger.Infof("Reveiced a %s event on file %s", eventtype, iRODSPath)
+
+	actions, ok := svc.Policy.Match(eventtype, iRODSPath)
+	if !ok {
+		logger.Infof("No policy rules match a %s event on file %s", eventtype, iRODSPath)
+		svc.Metrics.EventIgnored(EventIgnoredNoPolicy)
+		svc.recordSkippedEvent(event, iRODSPath, "no policy rules match")
+		return nil
+	}
+
+	if svc.Config.AVUPolicy {
+		isCollection := strings.HasPrefix(eventtype, "collection.")
+		avuPolicy := svc.getAVUPolicy(iRODSPath, isCollection)
+		if len(avuPolicy) > 0 {
+			avuActions, err := getAVUPolicyActions(avuPolicy, iRODSPath)
 			if err != nil {
-				logger.WithError(err).Errorf("Failed to create a PURGE request to url '%s' for host '%s'", requestURL, host)
-				return
+				logger.WithError(err).Warnf("Ignoring an invalid AVU policy for %s", iRODSPath)
+			} else if len(avuActions) == 0 {
+				logger.Infof("Skipping a %s event on file %s - AVU policy %s", eventtype, iRODSPath, avuPolicy)
+				svc.Metrics.EventIgnored(EventIgnoredAVUPolicy)
+				svc.recordSkippedEvent(event, iRODSPath, fmt.Sprintf("AVU policy %s", avuPolicy))
+				return nil
+			} else {
+				actions = append(append([]PurgeAction{}, actions...), avuActions...)
 			}
+		}
+	}
 
-			if len(hostOverride) > 0 {
-				req.Host = hostOverride
-			}
+	results := []*PurgeResult{}
+	for _, purgePath := range ExpandPurgeActions(actions, iRODSPath, event.UUID) {
+		purgePath.EventTime = event.Timestamp
+		purgePath.EventType = eventtype
+		results = append(results, svc.purgeCache(purgePath)...)
+	}
 
-			req.SetBasicAuth(svc.Config.IRODSUsername, svc.Config.IRODSPassword)
+	svc.recordPurges(&AuditEntry{
+		Event:   event,
+		Manual:  event.Manual,
+		Path:    iRODSPath,
+		Results: results,
+	})
+	return results
+}
 
-			response, err := http.DefaultClient.Do(req)
-			if err != nil {
-				logger.WithError(err).Errorf("Failed to make a PURGE request to url '%s' for host '%s'", requestURL, host)
-				return
+// recordSkippedEvent records the event that is not purged for the reason, path can be empty if not resolved
+func (svc *PurgemanService) recordSkippedEvent(event *FSEvent, path string, reason string) {
+	svc.recordPurges(&AuditEntry{
+		Event:   event,
+		Manual:  event.Manual,
+		Path:    path,
+		Skipped: reason,
+	})
+}
+
+// recordPurges records the entry for canaries, and appends it to the audit journal if enabled
+func (svc *PurgemanService) recordPurges(entry *AuditEntry) {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgemanService",
+		"function": "recordPurges",
+	})
+
+	entry.Time = time.Now()
+	svc.recordCanary(entry)
+
+	if svc.AuditJournal == nil {
+		return
+	}
+
+	err := svc.AuditJournal.Write(entry)
+	if err != nil {
+		logger.WithError(err).Error("Failed to write an audit entry")
+	}
+}
+
+// purgeCache purges cache, everything under the path is purged if it is a subtree
+// returns a result for each target
+func (svc *PurgemanService) purgeCache(purgePath PurgePath) []*PurgeResult {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgemanService",
+		"function": "purgeCache",
+	})
+
+	path := purgePath.Path
+
+	// purge cache on the path
+	if purgePath.Subtree {
+		logger.Infof("Purging a cache for %s and everything under it", path)
+	} else {
+		logger.Infof("Purging a cache for %s", path)
+	}
+
+	anonymousChecked := false
+	anonymousReadable := true
+
+	results := make([]*PurgeResult, len(svc.Targets))
+
+	wg := sync.WaitGroup{}
+	for idx, target := range svc.Targets {
+		result := &PurgeResult{
+			Target:  target.Config.Name,
+			Path:    path,
+			Subtree: purgePath.Subtree,
+		}
+		results[idx] = result
+
+		if !target.Accepts(path) {
+			result.Skipped = "filtered out"
+			continue
+		}
+
+		if target.IsExpired(purgePath.EventTime) {
+			logger.Debugf("Skipping target %s for %s - cached objects have expired already", target.Config.Name, path)
+			result.Skipped = "expired"
+			continue
+		}
+
+		if target.Config.Anonymous && svc.Config.ACLCheck {
+			if !anonymousChecked {
+				anonymousReadable = svc.isAnonymousReadable(path, purgePath.EventType)
+				anonymousChecked = true
 			}
 
-			if response.StatusCode < 200 || response.StatusCode >= 300 {
-				logger.Errorf("Unexpected response for a PURGE request to url '%s' for host '%s' - %s", requestURL, host, response.Status)
-				return
+			if !anonymousReadable {
+				logger.Debugf("Skipping anonymous target %s for %s - not readable by anonymous users", target.Config.Name, path)
+				result.Skipped = "not readable by anonymous users"
+				continue
 			}
 		}
 
-		go f(varnishURL)
+		wg.Add(1)
+
+		go func(target *PurgeTarget, result *PurgeResult) {
+			defer wg.Done()
+
+			requestResults, err := target.Purge(purgePath)
+			result.Requests = requestResults
+			if err != nil {
+				logger.WithError(err).Errorf("Failed to purge a cache for %s", path)
+				result.Error = err.Error()
+			}
+		}(target, result)
 	}
 
 	wg.Wait()
+	return results
 }
@@ -0,0 +1,345 @@
+package purgeman
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	irodsfs_clientfs "github.com/cyverse/go-irodsclient/fs"
+	irodsfs_session "github.com/cyverse/go-irodsclient/irods/session"
+	"github.com/cyverse/purgeman/pkg/commons"
+)
+
+// newTestService creates a service purging a test HTTP server, returns paths of purge requests received
+func newTestService(t *testing.T, modify func(config *commons.Config)) (*PurgemanService, func() []string) {
+	paths := []string{}
+	mutex := sync.Mutex{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		paths = append(paths, r.URL.Path)
+		mutex.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	config := commons.NewDefaultConfig()
+	config.IRODSZone = "iplant"
+	config.Targets = commons.TargetConfigs{
+		{
+			Name:      "test",
+			URLPrefix: server.URL,
+		},
+	}
+	config.ResolveStrategies = []string{commons.ResolveStrategyUUID}
+
+	if modify != nil {
+		modify(config)
+	}
+
+	svc, err := NewPurgeman(config)
+	if err != nil {
+		t.Fatalf("failed to create a service - %v", err)
+	}
+	t.Cleanup(svc.Destroy)
+
+	return svc, func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		received := make([]string, len(paths))
+		copy(received, paths)
+		return received
+	}
+}
+
+func TestFSEventHandlerUpdatesUUIDCacheForIgnoredEvents(t *testing.T) {
+	svc, received := newTestService(t, func(config *commons.Config) {
+		config.IgnoreUsers = []string{"bot"}
+	})
+
+	svc.UUIDCache.Put("uuid1", "/iplant/home/user/old.txt")
+
+	// moved by an ignored user, nothing is purged
+	svc.fsEventHandler(&FSEvent{
+		EventType: "data-object.mv",
+		OldPath:   "/iplant/home/user/old.txt",
+		Path:      "/iplant/home/user/new.txt",
+		UUID:      "uuid1",
+		Body: map[string]interface{}{
+			"author": map[string]interface{}{
+				"name": "bot",
+			},
+		},
+	})
+
+	if paths := received(); len(paths) != 0 {
+		t.Fatalf("expected no purges for an ignored event, got %v", paths)
+	}
+
+	path, ok := svc.UUIDCache.Get("uuid1")
+	if !ok || path != "/iplant/home/user/new.txt" {
+		t.Fatalf("expected the UUID cache to follow the ignored mv, got %q (%t)", path, ok)
+	}
+
+	// modified later by a user, resolved by the UUID
+	svc.fsEventHandler(&FSEvent{
+		EventType: "data-object.mod",
+		UUID:      "uuid1",
+		Body: map[string]interface{}{
+			"author": map[string]interface{}{
+				"name": "user",
+			},
+		},
+	})
+
+	purged := map[string]bool{}
+	for _, path := range received() {
+		purged[path] = true
+	}
+
+	if !purged["/iplant/home/user/new.txt"] || purged["/iplant/home/user/old.txt"] {
+		t.Fatalf("expected a purge of the new path only, got %v", received())
+	}
+}
+
+func TestFSEventHandlerEvictsUUIDCacheForIgnoredRemovals(t *testing.T) {
+	svc, _ := newTestService(t, func(config *commons.Config) {
+		config.IgnoreUsers = []string{"bot"}
+	})
+
+	svc.UUIDCache.Put("uuid1", "/iplant/home/user/file.txt")
+
+	svc.fsEventHandler(&FSEvent{
+		EventType: "data-object.rm",
+		Path:      "/iplant/home/user/file.txt",
+		UUID:      "uuid1",
+		Body: map[string]interface{}{
+			"author": map[string]interface{}{
+				"name": "bot",
+			},
+		},
+	})
+
+	if path, ok := svc.UUIDCache.Get("uuid1"); ok {
+		t.Fatalf("expected the UUID to be evicted, got %q", path)
+	}
+}
+
+func TestNewPurgemanIgnoresSharedPathsInDryRun(t *testing.T) {
+	svc, _ := newTestService(t, func(config *commons.Config) {
+		config.DryRun = true
+		config.DeadLetterPath = "/var/lib/purgeman/dead_letters.jsonl"
+		config.PendingSpillPath = "/var/lib/purgeman/pending.jsonl"
+		config.CapturePath = "/var/lib/purgeman/capture.jsonl"
+		config.AuditJournalPath = "/var/lib/purgeman/audit.jsonl"
+	})
+
+	if svc.DeadLetterWriter != nil {
+		t.Errorf("expected no dead letter writer in dry-run mode")
+	}
+
+	if len(svc.PendingEvents.SpillPath) > 0 {
+		t.Errorf("expected no spill path in dry-run mode, got %s", svc.PendingEvents.SpillPath)
+	}
+
+	if svc.Capture != nil {
+		t.Errorf("expected no capture in dry-run mode")
+	}
+
+	if svc.AuditJournal != nil {
+		t.Errorf("expected no audit journal in dry-run mode")
+	}
+}
+
+// fakeIRODSConnectionPool is a connection pool without connections, it records releases
+type fakeIRODSConnectionPool struct {
+	released chan bool
+}
+
+func (pool *fakeIRODSConnectionPool) Get() (interface{}, error) {
+	return nil, fmt.Errorf("no connections")
+}
+
+func (pool *fakeIRODSConnectionPool) Put(conn interface{}) error {
+	return nil
+}
+
+func (pool *fakeIRODSConnectionPool) Close(conn interface{}) error {
+	return nil
+}
+
+func (pool *fakeIRODSConnectionPool) Release() {
+	close(pool.released)
+}
+
+func (pool *fakeIRODSConnectionPool) Len() int {
+	return 0
+}
+
+func TestDestroyDoesNotWaitForIRODSLookups(t *testing.T) {
+	svc, _ := newTestService(t, nil)
+
+	pool := &fakeIRODSConnectionPool{
+		released: make(chan bool),
+	}
+	svc.IRODSClient = &irodsfs_clientfs.FileSystem{
+		Session: &irodsfs_session.IRODSSession{
+			ConnectionPool: pool,
+		},
+	}
+
+	started := make(chan bool)
+	finish := make(chan bool)
+	lookupDone := make(chan error)
+	go func() {
+		lookupDone <- svc.withIRODSClient(func(fsClient *irodsfs_clientfs.FileSystem) error {
+			close(started)
+			<-finish
+			return nil
+		})
+	}()
+	<-started
+
+	destroyed := make(chan bool)
+	go func() {
+		svc.Destroy()
+		close(destroyed)
+	}()
+
+	select {
+	case <-destroyed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Destroy waits for a lookup in progress")
+	}
+
+	select {
+	case <-pool.released:
+	default:
+		t.Error("expected the iRODS session to be released")
+	}
+
+	close(finish)
+	if err := <-lookupDone; err != nil {
+		t.Errorf("expected the lookup in progress to finish on its own, got %v", err)
+	}
+
+	if svc.getIRODSClient() != nil {
+		t.Error("expected no iRODS client after Destroy")
+	}
+}
+
+func TestDestroyDoesNotHoldMutexWhileStoppingHTTPServer(t *testing.T) {
+	svc, _ := newTestService(t, nil)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan bool)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+
+			// handlers like the admin API need the service mutex while the server shuts down
+			<-svc.TerminateChan
+			svc.isTerminated()
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+	go server.Serve(listener)
+
+	svc.Mutex.Lock()
+	svc.HTTPServer = server
+	svc.Mutex.Unlock()
+
+	go http.Get(fmt.Sprintf("http://%s/", listener.Addr().String()))
+	<-started
+
+	destroyed := make(chan bool)
+	go func() {
+		svc.Destroy()
+		close(destroyed)
+	}()
+
+	select {
+	case <-destroyed:
+	case <-time.After(HTTPShutdownTimeout / 2):
+		t.Fatal("Destroy holds the service mutex while waiting for HTTP requests in progress")
+	}
+}
+
+// countingIRODSConnectionPool is a connection pool without connections, it records the most gets in progress at once
+type countingIRODSConnectionPool struct {
+	active    int
+	maxActive int
+	mutex     sync.Mutex
+}
+
+func (pool *countingIRODSConnectionPool) Get() (interface{}, error) {
+	pool.mutex.Lock()
+	pool.active++
+	if pool.active > pool.maxActive {
+		pool.maxActive = pool.active
+	}
+	pool.mutex.Unlock()
+
+	// a slow lookup
+	time.Sleep(10 * time.Millisecond)
+
+	pool.mutex.Lock()
+	pool.active--
+	pool.mutex.Unlock()
+	return nil, fmt.Errorf("no connections")
+}
+
+func (pool *countingIRODSConnectionPool) Put(conn interface{}) error {
+	return nil
+}
+
+func (pool *countingIRODSConnectionPool) Close(conn interface{}) error {
+	return nil
+}
+
+func (pool *countingIRODSConnectionPool) Release() {
+}
+
+func (pool *countingIRODSConnectionPool) Len() int {
+	return 0
+}
+
+func TestIRODSLookupsAreLimitedToConnectionMax(t *testing.T) {
+	config := commons.NewDefaultConfig()
+	config.IRODSConnectionMax = 2
+
+	svc, err := NewPurgeman(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Destroy()
+
+	pool := &countingIRODSConnectionPool{}
+	svc.IRODSClient = &irodsfs_clientfs.FileSystem{
+		Session: &irodsfs_session.IRODSSession{
+			ConnectionPool: pool,
+		},
+	}
+
+	wg := sync.WaitGroup{}
+	for idx := 0; idx < 10; idx++ {
+		wg.Add(1)
+		go func(uuid string) {
+			defer wg.Done()
+			svc.fetchIRODSPathsByUUID(uuid)
+		}(fmt.Sprintf("uuid%d", idx))
+	}
+	wg.Wait()
+
+	if pool.maxActive == 0 || pool.maxActive > config.IRODSConnectionMax {
+		t.Errorf("expected at most %d lookups at once, got %d", config.IRODSConnectionMax, pool.maxActive)
+	}
+}
@@ -0,0 +1,397 @@
+package purgeman
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+	log "github.com/sirupsen/logrus"
+)
+
+// PurgeTarget is a web cache that receives purge requests
+type PurgeTarget struct {
+	Config     *commons.TargetConfig
+	URLMapper  *URLMapper
+	PathFilter *PathFilter
+	Username   string
+	Password   string
+	HTTPClient *http.Client
+	Metrics    *Metrics       // can be nil
+	Health     *HealthTracker // can be nil
+	DryRun     *DryRunWriter  // records requests instead of sending them if not nil
+}
+
+// NewPurgeTarget creates a new PurgeTarget
+// iRODS username and password are used when the target uses irods auth type
+func NewPurgeTarget(config *commons.TargetConfig, irodsUsername string, irodsPassword string) (*PurgeTarget, error) {
+	mapper, err := NewURLMapper(config.URLPrefix, config.Rewrites)
+	if err != nil {
+		return nil, err
+	}
+
+	pathFilter, err := NewPathFilter(config.PathIncludes, config.PathExcludes)
+	if err != nil {
+		return nil, err
+	}
+
+	username := ""
+	password := ""
+	switch config.GetAuthType() {
+	case commons.TargetAuthIRODS:
+		username = irodsUsername
+		password = irodsPassword
+	case commons.TargetAuthBasic:
+		username = config.Auth.Username
+		password = config.Auth.Password
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   config.GetConnectTimeout(),
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   config.GetConnectTimeout(),
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	return &PurgeTarget{
+		Config:     config,
+		URLMapper:  mapper,
+		PathFilter: pathFilter,
+		Username:   username,
+		Password:   password,
+		HTTPClient: &http.Client{
+			Transport: transport,
+			Timeout:   config.GetTimeout(),
+		},
+	}, nil
+}
+
+// newPurgeTargets creates purge targets from configuration
+// dryRun is nil unless the service runs in dry-run mode
+func newPurgeTargets(config *commons.Config, metrics *Metrics, health *HealthTracker, dryRun *DryRunWriter) ([]*PurgeTarget, error) {
+	targets := []*PurgeTarget{}
+	for idx := range config.Targets {
+		targetConfig := &config.Targets[idx]
+
+		target, err := NewPurgeTarget(targetConfig, config.IRODSUsername, config.IRODSPassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create a purge target %s - %v", targetConfig.Name, err)
+		}
+
+		target.Metrics = metrics
+		target.Health = health
+
+		if dryRun != nil {
+			target.DryRun = dryRun
+			health.Set(target.healthComponent(), true, "dry run")
+		} else if config.TargetProbeInterval > 0 {
+			// not ready until a probe gets a response
+			health.Set(target.healthComponent(), false, "not probed yet")
+		} else {
+			// assume reachable until a purge fails to connect
+			health.Set(target.healthComponent(), true, "no purges yet")
+		}
+
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
+// Accepts checks if the target purges the iRODS path
+func (target *PurgeTarget) Accepts(path string) bool {
+	return target.PathFilter.Accepts(path)
+}
+
+// IsExpired checks if objects cached before the event time have expired already
+func (target *PurgeTarget) IsExpired(eventTime time.Time) bool {
+	if target.Config.MaxAge <= 0 || eventTime.IsZero() {
+		return false
+	}
+
+	return time.Since(eventTime) > target.Config.MaxAge
+}
+
+// PurgeRequest is a purge request to be sent to a target
+type PurgeRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Host    string            `json:"host"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// PurgeRequestResult is an outcome of a purge request
+type PurgeRequestResult struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Host    string            `json:"host"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Status  int               `json:"status,omitempty"` // status code of the response, 0 if no response
+	Error   string            `json:"error,omitempty"`
+}
+
+// Request returns the purge request of the result
+func (result *PurgeRequestResult) Request() *PurgeRequest {
+	return &PurgeRequest{
+		Method:  result.Method,
+		URL:     result.URL,
+		Host:    result.Host,
+		Headers: result.Headers,
+	}
+}
+
+// getHost returns a host header value for the URL
+func (target *PurgeTarget) getHost(requestURL string) (string, error) {
+	if len(target.Config.HostOverride) > 0 {
+		return target.Config.HostOverride, nil
+	}
+
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse a request '%s' - %v", requestURL, err)
+	}
+
+	return u.Host, nil
+}
+
+// MakeRequests returns purge requests for the iRODS path, one for the URL, one for each variant and one for each URL template
+func (target *PurgeTarget) MakeRequests(purgePath PurgePath) ([]*PurgeRequest, error) {
+	if purgePath.Subtree {
+		request, err := target.MakeSubtreeRequest(purgePath.Path)
+		if err != nil {
+			return nil, err
+		}
+		return []*PurgeRequest{request}, nil
+	}
+
+	path := purgePath.Path
+	baseURL := target.URLMapper.MapPath(path)
+
+	host, err := target.getHost(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	method := target.Config.GetMethod()
+
+	requests := []*PurgeRequest{
+		{
+			Method: method,
+			URL:    baseURL,
+			Host:   host,
+		},
+	}
+
+	for _, variant := range target.Config.Variants {
+		requestURL := baseURL
+		if len(variant.Suffix) > 0 {
+			if strings.HasSuffix(requestURL, "/") {
+				requestURL = requestURL + strings.TrimLeft(variant.Suffix, "/")
+			} else {
+				requestURL = requestURL + variant.Suffix
+			}
+		}
+
+		if len(variant.Query) > 0 {
+			requestURL = requestURL + "?" + strings.TrimLeft(variant.Query, "?")
+		}
+
+		if requestURL == baseURL && len(variant.Headers) == 0 {
+			// same as the base request
+			continue
+		}
+
+		requests = append(requests, &PurgeRequest{
+			Method:  method,
+			URL:     requestURL,
+			Host:    host,
+			Headers: variant.Headers,
+		})
+	}
+
+	for _, template := range target.Config.URLTemplates {
+		requestURL, ok := target.URLMapper.MapTemplate(template, path, purgePath.UUID)
+		if !ok || requestURL == baseURL {
+			// e.g., UUID of the path is unknown
+			continue
+		}
+
+		templateHost, err := target.getHost(requestURL)
+		if err != nil {
+			return nil, err
+		}
+
+		requests = append(requests, &PurgeRequest{
+			Method: method,
+			URL:    requestURL,
+			Host:   templateHost,
+		})
+	}
+
+	return requests, nil
+}
+
+// MakeSubtreeRequest returns a request to purge everything under the iRODS path
+// Varnish needs a VCL that bans URLs matching the request URL as a regex
+func (target *PurgeTarget) MakeSubtreeRequest(path string) (*PurgeRequest, error) {
+	requestURL := target.URLMapper.MapPath(path)
+	if target.Config.GetBackend() == commons.TargetBackendNginx {
+		requestURL = requestURL + "*"
+	}
+
+	host, err := target.getHost(requestURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PurgeRequest{
+		Method: target.Config.GetSubtreeMethod(),
+		URL:    requestURL,
+		Host:   host,
+	}, nil
+}
+
+// Purge sends purge requests for the iRODS path, or a request for everything under the path if it is a subtree
+// returns an outcome of each request
+func (target *PurgeTarget) Purge(purgePath PurgePath) ([]*PurgeRequestResult, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgeTarget",
+		"function": "Purge",
+	})
+
+	requests, err := target.MakeRequests(purgePath)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*PurgeRequestResult{}
+	failed := 0
+	for _, request := range requests {
+		result := &PurgeRequestResult{
+			Method:  request.Method,
+			URL:     request.URL,
+			Host:    request.Host,
+			Headers: request.Headers,
+		}
+		results = append(results, result)
+
+		status, err := target.Send(request)
+		result.Status = status
+		if err != nil {
+			logger.Error(err)
+			result.Error = err.Error()
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d purge requests to target %s failed", failed, len(requests), target.Config.Name)
+	}
+	return results, nil
+}
+
+// Send sends a purge request, returns the status code of the response, 0 if no response
+func (target *PurgeTarget) Send(request *PurgeRequest) (int, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgeTarget",
+		"function": "Send",
+	})
+
+	req, err := http.NewRequest(request.Method, request.URL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create a %s request to url '%s' for host '%s' - %v", request.Method, request.URL, request.Host, err)
+	}
+
+	if len(target.Config.HostOverride) > 0 {
+		req.Host = target.Config.HostOverride
+	}
+
+	for name, value := range request.Headers {
+		req.Header.Set(name, value)
+	}
+
+	switch target.Config.GetAuthType() {
+	case commons.TargetAuthIRODS, commons.TargetAuthBasic:
+		req.SetBasicAuth(target.Username, target.Password)
+	case commons.TargetAuthBearer:
+		req.Header.Set("Authorization", "Bearer "+target.Config.Auth.Token)
+	}
+
+	if target.DryRun != nil {
+		return 0, target.planRequest(request, req)
+	}
+
+	logger.Infof("Sending a %s request to '%s' for host '%s' (target %s)", request.Method, request.URL, request.Host, target.Config.Name)
+
+	startTime := time.Now()
+	response, err := target.HTTPClient.Do(req)
+	if err != nil {
+		target.Metrics.ObservePurge(target.Config.Name, 0, time.Since(startTime))
+		target.Health.SetError(target.healthComponent(), err)
+		return 0, fmt.Errorf("failed to make a %s request to url '%s' for host '%s' - %v", request.Method, request.URL, request.Host, err)
+	}
+	defer response.Body.Close()
+
+	target.Metrics.ObservePurge(target.Config.Name, response.StatusCode, time.Since(startTime))
+	// any response means the target is reachable
+	target.Health.Set(target.healthComponent(), true, fmt.Sprintf("last response %s", response.Status))
+
+	if !target.isSuccess(response.StatusCode) {
+		return response.StatusCode, fmt.Errorf("unexpected response for a %s request to url '%s' for host '%s' - %s", request.Method, request.URL, request.Host, response.Status)
+	}
+
+	return response.StatusCode, nil
+}
+
+// planRequest records the request in dry-run mode instead of sending it, credentials are redacted
+func (target *PurgeTarget) planRequest(request *PurgeRequest, req *http.Request) error {
+	// plans are shared for review, header values may carry credentials
+	headers := map[string]string{}
+	for name := range req.Header {
+		headers[name] = commons.RedactedValue
+	}
+
+	err := target.DryRun.Write(&PurgePlan{
+		Time:    time.Now(),
+		Target:  target.Config.Name,
+		Method:  req.Method,
+		URL:     request.URL,
+		Host:    request.Host,
+		Headers: headers,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record a %s request to url '%s' for host '%s' - %v", request.Method, request.URL, request.Host, err)
+	}
+	return nil
+}
+
+// healthComponent returns the name of the target in health reports
+func (target *PurgeTarget) healthComponent() string {
+	return TargetComponentPrefix + target.Config.Name
+}
+
+// isSuccess checks if the response status code means the purge succeeded
+func (target *PurgeTarget) isSuccess(statusCode int) bool {
+	if statusCode >= 200 && statusCode < 300 {
+		return true
+	}
+
+	// ngx_cache_purge responds 404 if nothing is cached for the URL
+	if target.Config.GetBackend() == commons.TargetBackendNginx && statusCode == http.StatusNotFound {
+		return true
+	}
+
+	return false
+}
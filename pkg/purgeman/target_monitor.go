@@ -0,0 +1,41 @@
+package purgeman
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// monitorTargets probes purge targets periodically, returns when the service is terminated
+// targets are healthy only when they respond, so readiness does not depend on purges being made
+func (svc *PurgemanService) monitorTargets() {
+	for !svc.isTerminated() {
+		svc.probeTargets()
+
+		svc.sleep(svc.Config.TargetProbeInterval)
+	}
+}
+
+// probeTargets probes all purge targets in parallel, so a slow target does not delay the others
+func (svc *PurgemanService) probeTargets() {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"struct":   "PurgemanService",
+		"function": "probeTargets",
+	})
+
+	wg := sync.WaitGroup{}
+	for _, target := range svc.Targets {
+		wg.Add(1)
+		go func(target *PurgeTarget) {
+			defer wg.Done()
+
+			_, _, err := target.Probe(svc.Config.IRODSZone)
+			if err != nil {
+				logger.WithError(err).Warnf("Failed to probe target %s", target.Config.Name)
+			}
+		}(target)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,103 @@
+package purgeman
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+)
+
+func TestProbeTargetsSetsHealth(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(failing.Close)
+
+	svc, received := newTestService(t, func(config *commons.Config) {
+		config.TargetProbeInterval = time.Minute
+		config.Targets = append(config.Targets, commons.TargetConfig{
+			Name: "down",
+			// nothing listens on the discard port
+			URLPrefix: "http://127.0.0.1:9",
+		}, commons.TargetConfig{
+			Name:      "failing",
+			URLPrefix: failing.URL,
+		})
+	})
+
+	components := svc.Health.Snapshot()
+	for _, name := range []string{"target:test", "target:down", "target:failing"} {
+		if components[name].Healthy {
+			t.Errorf("expected %s to be unhealthy before probes", name)
+		}
+	}
+
+	svc.probeTargets()
+
+	components = svc.Health.Snapshot()
+	if !components["target:test"].Healthy {
+		t.Errorf("expected a reachable target to be healthy, got %+v", components["target:test"])
+	}
+
+	// health follows the same rule as purges, any response means the target is reachable
+	if !components["target:failing"].Healthy {
+		t.Errorf("expected a target responding an error to be healthy, got %+v", components["target:failing"])
+	}
+
+	if components["target:down"].Healthy {
+		t.Errorf("expected an unreachable target to be unhealthy, got %+v", components["target:down"])
+	}
+
+	paths := received()
+	if len(paths) != 1 || !strings.Contains(paths[0], CheckPathName) {
+		t.Errorf("expected a probe request, got %v", paths)
+	}
+}
+
+func TestIsReady(t *testing.T) {
+	tests := []struct {
+		name       string
+		components map[string]ComponentHealth
+		ready      bool
+	}{
+		{"all healthy", map[string]ComponentHealth{
+			ComponentAMQP:  {Healthy: true},
+			ComponentIRODS: {Healthy: true},
+			"target:a":     {Healthy: false},
+			"target:b":     {Healthy: true},
+		}, true},
+		{"no targets reachable", map[string]ComponentHealth{
+			ComponentAMQP:  {Healthy: true},
+			ComponentIRODS: {Healthy: true},
+			"target:a":     {Healthy: false},
+		}, false},
+		{"iRODS down", map[string]ComponentHealth{
+			ComponentAMQP:  {Healthy: true},
+			ComponentIRODS: {Healthy: false},
+			"target:a":     {Healthy: true},
+		}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if isReady(test.components) != test.ready {
+				t.Errorf("expected ready %t", test.ready)
+			}
+		})
+	}
+}
+
+func TestTargetsAreHealthyWithoutProbes(t *testing.T) {
+	svc, _ := newTestService(t, nil)
+
+	if svc.Config.TargetProbeInterval != 0 {
+		t.Errorf("expected probes to be disabled by default, got %s", svc.Config.TargetProbeInterval)
+	}
+
+	if !svc.Health.Snapshot()["target:test"].Healthy {
+		t.Error("expected targets to be healthy until a purge fails to connect")
+	}
+}
@@ -0,0 +1,53 @@
+package purgeman
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+)
+
+func TestPurgeTargetMakeRequestsWithVariants(t *testing.T) {
+	variants := []commons.URLVariant{
+		{Suffix: "/"},
+		{Query: "?ls"},
+		{Suffix: "/", Query: "ls"},
+		{Headers: map[string]string{"Accept": "text/html"}},
+		// same as the base request
+		{},
+	}
+
+	target, err := NewPurgeTarget(&commons.TargetConfig{
+		Name:         "test",
+		URLPrefix:    "http://127.0.0.1:6081/dav",
+		HostOverride: "cache.example.org",
+		Variants:     variants,
+	}, "user", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests, err := target.MakeRequests(PurgePath{Path: "/iplant/home/user/dir"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseURL := "http://127.0.0.1:6081/dav/iplant/home/user/dir"
+	expected := []*PurgeRequest{
+		{Method: "PURGE", URL: baseURL, Host: "cache.example.org"},
+		{Method: "PURGE", URL: baseURL + "/", Host: "cache.example.org"},
+		{Method: "PURGE", URL: baseURL + "?ls", Host: "cache.example.org"},
+		{Method: "PURGE", URL: baseURL + "/?ls", Host: "cache.example.org"},
+		{Method: "PURGE", URL: baseURL, Host: "cache.example.org", Headers: map[string]string{"Accept": "text/html"}},
+	}
+
+	if len(requests) != len(expected) {
+		t.Fatalf("expected %d requests, got %d", len(expected), len(requests))
+	}
+
+	for idx := range expected {
+		if !reflect.DeepEqual(requests[idx], expected[idx]) {
+			t.Errorf("expected %+v, got %+v", *expected[idx], *requests[idx])
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package purgeman
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var templatePlaceholderRegex = regexp.MustCompile(`\{[a-z]+\}`)
+
+// newTemplateValues returns values of template placeholders for the path
+// supported placeholders are {path}, {parent}, {basename}, {extension}, {uuid} and {zone}
+func newTemplateValues(p string, uuid string, zone string) map[string]string {
+	basename := path.Base(p)
+
+	return map[string]string{
+		"path":      p,
+		"parent":    path.Dir(p),
+		"basename":  basename,
+		"extension": strings.TrimPrefix(path.Ext(basename), "."),
+		"uuid":      uuid,
+		"zone":      zone,
+	}
+}
+
+// expandTemplate replaces placeholders in the template with the values
+// returns false if a placeholder used in the template has no value, e.g., UUID is unknown
+func expandTemplate(template string, values map[string]string) (string, bool) {
+	logger := log.WithFields(log.Fields{
+		"package":  "purgeman",
+		"function": "expandTemplate",
+	})
+
+	ok := true
+	expanded := templatePlaceholderRegex.ReplaceAllStringFunc(template, func(placeholder string) string {
+		value, known := values[strings.Trim(placeholder, "{}")]
+		if !known {
+			// not a placeholder
+			return placeholder
+		}
+
+		if len(value) == 0 {
+			logger.Debugf("Skipping template %s - placeholder %s has no value", template, placeholder)
+			ok = false
+		}
+		return value
+	})
+
+	return expanded, ok
+}
+
+// getIRODSZone returns the zone of the iRODS path
+func getIRODSZone(irodsPath string) string {
+	segments := strings.SplitN(strings.TrimPrefix(irodsPath, "/"), "/", 2)
+	return segments[0]
+}
+
+// expandPathTemplate replaces placeholders in the template with values derived from the iRODS path
+func expandPathTemplate(template string, irodsPath string, uuid string) (string, bool) {
+	return expandTemplate(template, newTemplateValues(irodsPath, uuid, getIRODSZone(irodsPath)))
+}
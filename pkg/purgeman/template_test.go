@@ -0,0 +1,53 @@
+package purgeman
+
+import "testing"
+
+func TestExpandTemplate(t *testing.T) {
+	values := newTemplateValues("/iplant/home/user/photo.jpg", "", "iplant")
+
+	tests := []struct {
+		name     string
+		template string
+		expanded string
+		ok       bool
+	}{
+		{"path", "/thumbnails{path}?size=256", "/thumbnails/iplant/home/user/photo.jpg?size=256", true},
+		{"parent and basename", "{parent}/.preview/{basename}", "/iplant/home/user/.preview/photo.jpg", true},
+		{"extension and zone", "/{zone}/types/{extension}", "/iplant/types/jpg", true},
+		{"unknown placeholder", "/static/{name}{path}", "/static/{name}/iplant/home/user/photo.jpg", true},
+		{"empty placeholder", "/uuid/{uuid}", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expanded, ok := expandTemplate(test.template, values)
+			if ok != test.ok {
+				t.Fatalf("expected ok %t, got %t", test.ok, ok)
+			}
+
+			if ok && expanded != test.expanded {
+				t.Errorf("expected %s, got %s", test.expanded, expanded)
+			}
+		})
+	}
+}
+
+func TestNewTemplateValues(t *testing.T) {
+	tests := []struct {
+		path      string
+		parent    string
+		basename  string
+		extension string
+	}{
+		{"/iplant/home/user/photo.jpg", "/iplant/home/user", "photo.jpg", "jpg"},
+		{"/iplant/home/user/archive.tar.gz", "/iplant/home/user", "archive.tar.gz", "gz"},
+		{"/iplant/home/user", "/iplant/home", "user", ""},
+	}
+
+	for _, test := range tests {
+		values := newTemplateValues(test.path, "uuid", "iplant")
+		if values["parent"] != test.parent || values["basename"] != test.basename || values["extension"] != test.extension {
+			t.Errorf("unexpected values %v for %s", values, test.path)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package purgeman
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+)
+
+// urlRewriteRule is a compiled commons.URLRewriteRule
+type urlRewriteRule struct {
+	Prefix  string
+	Regex   *regexp.Regexp
+	Replace string
+}
+
+// URLMapper maps iRODS paths to URLs of a purge target
+type URLMapper struct {
+	URLPrefix string
+	// URLOrigin is the scheme and host of URLPrefix, templates starting with "/" are relative to it
+	URLOrigin string
+	rules     []urlRewriteRule
+}
+
+// NewURLMapper creates a new URLMapper
+func NewURLMapper(urlPrefix string, rules []commons.URLRewriteRule) (*URLMapper, error) {
+	compiledRules := []urlRewriteRule{}
+	for _, rule := range rules {
+		compiledRule := urlRewriteRule{
+			Prefix:  rule.Prefix,
+			Replace: rule.Replace,
+		}
+
+		if len(rule.Regex) > 0 {
+			regex, err := regexp.Compile(rule.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compile a rewrite regex '%s' - %v", rule.Regex, err)
+			}
+
+			compiledRule.Regex = regex
+		}
+
+		compiledRules = append(compiledRules, compiledRule)
+	}
+
+	u, err := url.Parse(urlPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL prefix '%s' - %v", urlPrefix, err)
+	}
+
+	return &URLMapper{
+		URLPrefix: strings.TrimRight(urlPrefix, "/"),
+		URLOrigin: u.Scheme + "://" + u.Host,
+		rules:     compiledRules,
+	}, nil
+}
+
+// RewritePath rewrites the iRODS path using the first matching rule
+func (mapper *URLMapper) RewritePath(path string) string {
+	for _, rule := range mapper.rules {
+		if rule.Regex != nil {
+			if rule.Regex.MatchString(path) {
+				return rule.Regex.ReplaceAllString(path, rule.Replace)
+			}
+		} else if len(rule.Prefix) > 0 && isPathUnder(path, rule.Prefix) {
+			return rule.Replace + strings.TrimPrefix(path, strings.TrimRight(rule.Prefix, "/"))
+		}
+	}
+
+	return path
+}
+
+// MapPath returns an URL for the iRODS path, each path segment is percent-encoded
+func (mapper *URLMapper) MapPath(path string) string {
+	rewrittenPath := mapper.RewritePath(path)
+	return mapper.URLPrefix + escapeURLPath(rewrittenPath)
+}
+
+// MapTemplate returns an URL made from the template for the iRODS path
+// placeholders of path components are replaced with rewritten and percent-encoded values
+// returns false if a placeholder used in the template has no value
+func (mapper *URLMapper) MapTemplate(template string, path string, uuid string) (string, bool) {
+	rewrittenPath := mapper.RewritePath(path)
+
+	values := newTemplateValues(rewrittenPath, uuid, getIRODSZone(path))
+	for _, name := range []string{"path", "parent"} {
+		values[name] = escapeURLPath(values[name])
+	}
+
+	for _, name := range []string{"basename", "extension", "uuid", "zone"} {
+		values[name] = url.PathEscape(values[name])
+	}
+
+	expanded, ok := expandTemplate(template, values)
+	if !ok {
+		return "", false
+	}
+
+	if strings.HasPrefix(expanded, "/") {
+		return mapper.URLOrigin + expanded, true
+	}
+	return expanded, true
+}
+
+// escapeURLPath percent-encodes each segment of the path
+func escapeURLPath(path string) string {
+	segments := strings.Split(path, "/")
+	for idx, segment := range segments {
+		segments[idx] = url.PathEscape(segment)
+	}
+
+	escapedPath := strings.Join(segments, "/")
+	if !strings.HasPrefix(escapedPath, "/") {
+		escapedPath = "/" + escapedPath
+	}
+	return escapedPath
+}
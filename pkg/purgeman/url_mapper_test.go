@@ -0,0 +1,81 @@
+package purgeman
+
+import (
+	"testing"
+
+	"github.com/cyverse/purgeman/pkg/commons"
+)
+
+func TestURLMapperMapPath(t *testing.T) {
+	rules := []commons.URLRewriteRule{
+		{Prefix: "/iplant/home/shared/", Replace: "/shared"},
+		{Regex: "^/iplant/home/([^/]+)/public(/.*)?$", Replace: "/public/$1$2"},
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{"plain", "/iplant/home/user/a.txt", "http://127.0.0.1:6081/dav/iplant/home/user/a.txt"},
+		{"space", "/iplant/home/user/a b.txt", "http://127.0.0.1:6081/dav/iplant/home/user/a%20b.txt"},
+		{"reserved characters", "/iplant/home/user/a#b?c%d.txt", "http://127.0.0.1:6081/dav/iplant/home/user/a%23b%3Fc%25d.txt"},
+		{"unicode", "/iplant/home/user/café.txt", "http://127.0.0.1:6081/dav/iplant/home/user/caf%C3%A9.txt"},
+		{"prefix rewrite", "/iplant/home/shared/a.txt", "http://127.0.0.1:6081/dav/shared/a.txt"},
+		{"prefix rewrite of the prefix itself", "/iplant/home/shared", "http://127.0.0.1:6081/dav/shared"},
+		{"prefix rewrite of a sibling", "/iplant/home/shared2/a.txt", "http://127.0.0.1:6081/dav/iplant/home/shared2/a.txt"},
+		{"regex rewrite", "/iplant/home/user/public/a b.txt", "http://127.0.0.1:6081/dav/public/user/a%20b.txt"},
+	}
+
+	mapper, err := NewURLMapper("http://127.0.0.1:6081/dav/", rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mapped := mapper.MapPath(test.path)
+			if mapped != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, mapped)
+			}
+		})
+	}
+}
+
+func TestURLMapperMapTemplate(t *testing.T) {
+	mapper, err := NewURLMapper("http://127.0.0.1:6081/dav", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		uuid     string
+		expected string
+		ok       bool
+	}{
+		{"relative to origin", "/thumbnails{path}?size=256", "", "http://127.0.0.1:6081/thumbnails/iplant/home/user/a%20b.jpg?size=256", true},
+		{"absolute", "https://cdn.example.org/{basename}", "", "https://cdn.example.org/a%20b.jpg", true},
+		{"uuid", "/uuid/{uuid}", "abc-123", "http://127.0.0.1:6081/uuid/abc-123", true},
+		{"unknown uuid", "/uuid/{uuid}", "", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mapped, ok := mapper.MapTemplate(test.template, "/iplant/home/user/a b.jpg", test.uuid)
+			if ok != test.ok || mapped != test.expected {
+				t.Errorf("expected %s (%t), got %s (%t)", test.expected, test.ok, mapped, ok)
+			}
+		})
+	}
+}
+
+func TestNewURLMapperRejectsInvalidRegex(t *testing.T) {
+	_, err := NewURLMapper("http://127.0.0.1:6081/dav", []commons.URLRewriteRule{
+		{Regex: "(", Replace: "/"},
+	})
+	if err == nil {
+		t.Errorf("expected an error for an invalid regex")
+	}
+}
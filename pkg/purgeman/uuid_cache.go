@@ -0,0 +1,70 @@
+package purgeman
+
+import (
+	"strings"
+	"time"
+)
+
+// UUIDPathCache is a LRU cache that maps iRODS UUIDs to paths
+type UUIDPathCache struct {
+	*LRUCache
+}
+
+// NewUUIDPathCache creates a new UUIDPathCache
+func NewUUIDPathCache(maxSize int, ttl time.Duration) *UUIDPathCache {
+	return &UUIDPathCache{
+		LRUCache: NewLRUCache(maxSize, ttl),
+	}
+}
+
+// Get returns a path cached for the uuid
+func (cache *UUIDPathCache) Get(uuid string) (string, bool) {
+	value, ok := cache.LRUCache.Get(uuid)
+	if !ok {
+		return "", false
+	}
+	return value.(string), true
+}
+
+// Put adds or updates a path for the uuid
+func (cache *UUIDPathCache) Put(uuid string, path string) {
+	if len(path) == 0 {
+		return
+	}
+
+	cache.LRUCache.Put(uuid, path)
+}
+
+// MovePrefix updates paths of all entries under oldPrefix to be under newPrefix
+// this is used when a collection is moved
+func (cache *UUIDPathCache) MovePrefix(oldPrefix string, newPrefix string) {
+	// prefixes may end with "/", paths of entries do not
+	trimmedOldPrefix := strings.TrimRight(oldPrefix, "/")
+	trimmedNewPrefix := strings.TrimRight(newPrefix, "/")
+
+	cache.Update(func(uuid string, value interface{}) (interface{}, bool) {
+		path := value.(string)
+		if !isPathUnder(path, oldPrefix) {
+			return nil, false
+		}
+		return trimmedNewPrefix + path[len(trimmedOldPrefix):], true
+	})
+}
+
+// RemovePrefix evicts all entries under the prefix
+// this is used when a collection is removed
+func (cache *UUIDPathCache) RemovePrefix(prefix string) {
+	cache.RemoveIf(func(uuid string, value interface{}) bool {
+		return isPathUnder(value.(string), prefix)
+	})
+}
+
+// isPathUnder checks if the path is the prefix itself or is under the prefix
+func isPathUnder(path string, prefix string) bool {
+	trimmedPrefix := strings.TrimRight(prefix, "/")
+	if path == prefix || path == trimmedPrefix {
+		return true
+	}
+
+	return strings.HasPrefix(path, trimmedPrefix+"/")
+}
@@ -0,0 +1,122 @@
+package purgeman
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUUIDPathCacheLRU(t *testing.T) {
+	cache := NewUUIDPathCache(2, time.Hour)
+
+	cache.Put("uuid1", "/iplant/a")
+	cache.Put("uuid2", "/iplant/b")
+
+	// makes uuid2 the least recently used
+	if path, ok := cache.Get("uuid1"); !ok || path != "/iplant/a" {
+		t.Errorf("expected /iplant/a, got %q (%t)", path, ok)
+	}
+
+	cache.Put("uuid3", "/iplant/c")
+
+	if _, ok := cache.Get("uuid2"); ok {
+		t.Errorf("expected uuid2 to be evicted")
+	}
+
+	if cache.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", cache.Len())
+	}
+
+	hits, misses := cache.Stats()
+	if hits != 1 || misses != 1 {
+		t.Errorf("expected 1 hit and 1 miss, got %d and %d", hits, misses)
+	}
+}
+
+func TestUUIDPathCacheTTL(t *testing.T) {
+	cache := NewUUIDPathCache(10, time.Millisecond)
+	cache.Put("uuid1", "/iplant/a")
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := cache.Get("uuid1"); ok {
+		t.Errorf("expected uuid1 to expire")
+	}
+
+	if cache.Len() != 0 {
+		t.Errorf("expected an expired entry to be removed, got %d entries", cache.Len())
+	}
+}
+
+func TestUUIDPathCacheIgnoresInvalidEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int
+		uuid    string
+		path    string
+	}{
+		{"disabled", 0, "uuid1", "/iplant/a"},
+		{"empty uuid", 10, "", "/iplant/a"},
+		{"empty path", 10, "uuid1", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := NewUUIDPathCache(test.maxSize, time.Hour)
+			cache.Put(test.uuid, test.path)
+
+			if cache.Len() != 0 {
+				t.Errorf("expected no entries, got %d", cache.Len())
+			}
+		})
+	}
+}
+
+func TestUUIDPathCacheMovePrefix(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		oldPrefix string
+		newPrefix string
+		expected  string
+	}{
+		{"collection itself", "/iplant/home/a", "/iplant/home/a", "/iplant/home/b", "/iplant/home/b"},
+		{"under collection", "/iplant/home/a/x/y.txt", "/iplant/home/a", "/iplant/home/b", "/iplant/home/b/x/y.txt"},
+		{"prefix with slash", "/iplant/home/a/y.txt", "/iplant/home/a/", "/iplant/home/b/", "/iplant/home/b/y.txt"},
+		{"collection itself with slash", "/iplant/home/a", "/iplant/home/a/", "/iplant/home/b", "/iplant/home/b"},
+		{"sibling with the same prefix", "/iplant/home/ab/y.txt", "/iplant/home/a", "/iplant/home/b", "/iplant/home/ab/y.txt"},
+		{"not under", "/iplant/shared/y.txt", "/iplant/home/a", "/iplant/home/b", "/iplant/shared/y.txt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := NewUUIDPathCache(10, time.Hour)
+			cache.Put("uuid1", test.path)
+
+			cache.MovePrefix(test.oldPrefix, test.newPrefix)
+
+			path, ok := cache.Get("uuid1")
+			if !ok || path != test.expected {
+				t.Errorf("expected %s, got %q (%t)", test.expected, path, ok)
+			}
+		})
+	}
+}
+
+func TestUUIDPathCacheRemovePrefix(t *testing.T) {
+	cache := NewUUIDPathCache(10, time.Hour)
+	cache.Put("uuid1", "/iplant/home/a")
+	cache.Put("uuid2", "/iplant/home/a/b.txt")
+	cache.Put("uuid3", "/iplant/home/ab.txt")
+
+	cache.RemovePrefix("/iplant/home/a")
+
+	for _, uuid := range []string{"uuid1", "uuid2"} {
+		if _, ok := cache.Get(uuid); ok {
+			t.Errorf("expected %s to be removed", uuid)
+		}
+	}
+
+	if _, ok := cache.Get("uuid3"); !ok {
+		t.Errorf("expected uuid3 to be kept")
+	}
+}